@@ -29,10 +29,30 @@ type DatabaseConfig struct {
 	Port     int
 }
 
+// StorageConfig decides where uploaded files are stored. Driver is either "local" or "s3".
+type StorageConfig struct {
+	Driver            string
+	LocalDirectory    string
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKey       string
+	S3SecretKey       string
+	S3PathStyle       bool
+	MaxAttachmentSize int64
+}
+
+// SMTPConfig tells how emails are sent. TLS is either "none", "starttls" or "tls", the latter being implicit TLS from
+// the moment of connecting. Auth is either "plain" or "login", and is only done when Username is set.
 type SMTPConfig struct {
-	Enabled bool
-	Host    string
-	Port    string
+	Enabled  bool
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Auth     string
+	TLS      string
+	From     string
 }
 
 var (
@@ -44,6 +64,9 @@ var (
 
 	Mail SMTPConfig
 
+	// Storage contains configuration for storing attachments
+	Storage StorageConfig
+
 	Logger zerolog.Logger
 
 	version string
@@ -77,10 +100,27 @@ func init() {
 		Port:     envInt("DB_PORT", 3390),
 	}
 
+	Storage = StorageConfig{
+		Driver:            envString("STORAGE_DRIVER", "local"),
+		LocalDirectory:    envString("STORAGE_LOCAL_DIRECTORY", "./data/attachments"),
+		S3Endpoint:        envString("STORAGE_S3_ENDPOINT", ""),
+		S3Region:          envString("STORAGE_S3_REGION", "us-east-1"),
+		S3Bucket:          envString("STORAGE_S3_BUCKET", "chitchat"),
+		S3AccessKey:       envString("STORAGE_S3_ACCESS_KEY", ""),
+		S3SecretKey:       envString("STORAGE_S3_SECRET_KEY", ""),
+		S3PathStyle:       envBool("STORAGE_S3_PATH_STYLE", true),
+		MaxAttachmentSize: int64(envInt("MAX_ATTACHMENT_SIZE", 10<<20)),
+	}
+
 	Mail = SMTPConfig{
-		Enabled: envBool("SMTP_ENABLED", false),
-		Host:    envString("SMTP_HOST", ""),
-		Port:    envString("SMTP_PORT", "25"),
+		Enabled:  envBool("SMTP_ENABLED", false),
+		Host:     envString("SMTP_HOST", ""),
+		Port:     envString("SMTP_PORT", "587"),
+		Username: envString("SMTP_USERNAME", ""),
+		Password: envString("SMTP_PASSWORD", ""),
+		Auth:     envString("SMTP_AUTH", "plain"),
+		TLS:      envString("SMTP_TLS", "starttls"),
+		From:     envString("SMTP_FROM", fmt.Sprintf("chitchat@%s", App.Host)),
 	}
 
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
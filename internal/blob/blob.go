@@ -0,0 +1,16 @@
+// Package blob stores files, like attachments, outside the database.
+package blob
+
+import (
+	"io"
+)
+
+// Store keeps blobs by key. Keys are made of letters, digits, dashes and slashes only.
+type Store interface {
+	// Put stores size bytes read from content under key, replacing anything stored there before.
+	Put(key string, content io.Reader, size int64, contentType string) error
+	// Get returns the content stored under key, or app.ErrBlobNotFound. The caller must close it.
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes whatever is stored under key. Removing a missing blob is not an error.
+	Delete(key string) error
+}
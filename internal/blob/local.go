@@ -0,0 +1,62 @@
+package blob
+
+import (
+	"errors"
+	app "github.com/emilhauk/chitchat/internal"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps blobs as files in a directory on the local filesystem.
+type LocalStore struct {
+	directory string
+}
+
+func NewLocalStore(directory string) (LocalStore, error) {
+	err := os.MkdirAll(directory, 0o750)
+	return LocalStore{directory: directory}, err
+}
+
+func (s LocalStore) Put(key string, content io.Reader, _ int64, _ string) error {
+	path := s.path(key)
+	err := os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return err
+	}
+	// Written next to its destination first, so nobody ever reads a half-written blob
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (s LocalStore) Get(key string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, app.ErrBlobNotFound
+	}
+	return file, err
+}
+
+func (s LocalStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s LocalStore) path(key string) string {
+	// Cleaned as if rooted, so that no key can point outside the directory
+	return filepath.Join(s.directory, filepath.FromSlash(filepath.Clean("/"+key)))
+}
@@ -0,0 +1,69 @@
+package blob
+
+import (
+	"errors"
+	app "github.com/emilhauk/chitchat/internal"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorePath(t *testing.T) {
+	store := LocalStore{directory: filepath.FromSlash("/data/attachments")}
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "channels/a/b.png", want: "/data/attachments/channels/a/b.png"},
+		{key: "../secret", want: "/data/attachments/secret"},
+		{key: "../../etc/passwd", want: "/data/attachments/etc/passwd"},
+		{key: "channels/../../../etc/passwd", want: "/data/attachments/etc/passwd"},
+		{key: "/etc/passwd", want: "/data/attachments/etc/passwd"},
+		{key: "./channels//a/./b", want: "/data/attachments/channels/a/b"},
+		{key: "..", want: "/data/attachments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := store.path(tt.key); got != filepath.FromSlash(tt.want) {
+				t.Errorf("path(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	directory := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(directory, "attachments"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.Put("../outside", strings.NewReader("content"), 7, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(directory, "outside")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Put wrote outside the directory: %v", err)
+	}
+
+	reader, err := store.Get("outside")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(got) != "content" {
+		t.Errorf("Get returned %q, %v. Want %q", got, err, "content")
+	}
+
+	if err = store.Delete("outside"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err = store.Get("outside"); !errors.Is(err, app.ErrBlobNotFound) {
+		t.Errorf("Get after Delete returned %v, want app.ErrBlobNotFound", err)
+	}
+	if err = store.Delete("outside"); err != nil {
+		t.Errorf("Delete of missing key: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/emilhauk/chitchat/config"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+const (
+	maxAttachmentsPerMessage = 10
+	// maxMessageFormMemory is how much of a message form is kept in memory. Larger uploads are spooled to disk.
+	maxMessageFormMemory = 8 << 20
+)
+
+// parseMessageForm parses the message form, which is multipart when files are attached. The uploads are returned, and
+// must be removed with removeUploads once handled.
+func parseMessageForm(w http.ResponseWriter, r *http.Request) ([]model.Upload, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentsPerMessage*config.Storage.MaxAttachmentSize+1<<20)
+	err := r.ParseMultipartForm(maxMessageFormMemory)
+	if errors.Is(err, http.ErrNotMultipart) {
+		return nil, r.ParseForm()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := make([]model.Upload, 0)
+	files := r.MultipartForm.File["attachment"]
+	if len(files) > maxAttachmentsPerMessage {
+		return nil, fmt.Errorf("%d attachments is more than the %d allowed", len(files), maxAttachmentsPerMessage)
+	}
+	for _, header := range files {
+		// Browsers send an empty part when no file is chosen
+		if header.Filename == "" && header.Size == 0 {
+			continue
+		}
+		if header.Size > config.Storage.MaxAttachmentSize {
+			return nil, app.ErrAttachmentTooLarge
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, model.Upload{
+			FileName: header.Filename,
+			Size:     header.Size,
+			Content:  file,
+		})
+	}
+	return uploads, nil
+}
+
+func removeUploads(r *http.Request) {
+	if r.MultipartForm != nil {
+		_ = r.MultipartForm.RemoveAll()
+	}
+}
+
+func GetAttachment(w http.ResponseWriter, r *http.Request) {
+	serveAttachment(w, r, false)
+}
+
+func GetAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	serveAttachment(w, r, true)
+}
+
+func serveAttachment(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	attachmentUUID := chi.URLParam(r, "attachmentUUID")
+
+	attachment, content, err := chatService.GetAttachment(channelUUID, attachmentUUID, thumbnail, user)
+	if err != nil {
+		if errors.Is(err, app.ErrAttachmentNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Error().Err(err).Msgf("Failed to load attachment=%s for user=%s", attachmentUUID, user.UUID)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	// Only images known to be harmless are shown inline. Anything else, SVGs and HTML included, is downloaded.
+	disposition := "attachment"
+	contentType := attachment.ContentType
+	if attachment.IsImage() {
+		disposition = "inline"
+	} else if contentType == "text/html" || contentType == "text/xml" || contentType == "image/svg+xml" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	// Attachments never change, but are only for members to see
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	if !thumbnail {
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	}
+	_, err = io.Copy(w, content)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to send attachment=%s to user=%s", attachmentUUID, user.UUID)
+	}
+}
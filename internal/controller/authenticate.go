@@ -19,10 +19,7 @@ func CheckUsername(w http.ResponseWriter, r *http.Request) {
 		app.Redirect(w, r, getRequestedUrlOrDefault(r, "/error/internal-server-error"))
 		return
 	}
-	qs := ""
-	if values := internalMiddleware.ExtractAllowedSearchParams(r.URL); len(values) > 0 {
-		qs = fmt.Sprintf("?%s", values.Encode())
-	}
+	qs := allowedQueryString(r)
 
 	email := strings.ToLower(r.FormValue("email"))
 	if _, err = mail.ParseAddress(email); err != nil {
@@ -84,12 +81,24 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	request.PlainPassword = ""
 
 	if err != nil {
-		// Several validation errors may occur here. Non is handled yet, just internal server error for now
+		// Several validation errors may occur here. Only a wrong code is handled yet, the rest are internal server errors for now
 		switch {
+		case errors.Is(err, app.ErrFieldVerificationCodeInvalid), errors.Is(err, app.ErrFieldVerificationExpired):
+			err = tmpl.ExecuteTemplate(w, "register-form", map[string]any{
+				"RegisterSession":          request.VerificationUUID,
+				"RequireEmailVerification": config.Mail.Enabled,
+				"CodeInvalid":              errors.Is(err, app.ErrFieldVerificationCodeInvalid),
+				"CodeExpired":              errors.Is(err, app.ErrFieldVerificationExpired),
+				"Email":                    r.FormValue("email"),
+				"Name":                     request.Name,
+				"QueryString":              allowedQueryString(r),
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to render registration form")
+			}
+			return
 		case errors.Is(err, app.ErrFieldVerificationNotFound):
 			fallthrough
-		case errors.Is(err, app.ErrFieldVerificationCodeInvalid):
-			fallthrough
 		default:
 			log.Error().Err(err).Any("user", request).Msg("Failed to register user")
 			app.Redirect(w, r, "/error/internal-server-error")
@@ -145,6 +154,14 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 	app.Redirect(w, r, "/")
 }
 
+// allowedQueryString returns the allowed search params of the request, ready to be added to a URL.
+func allowedQueryString(r *http.Request) string {
+	if values := internalMiddleware.ExtractAllowedSearchParams(r.URL); len(values) > 0 {
+		return fmt.Sprintf("?%s", values.Encode())
+	}
+	return ""
+}
+
 func getRequestedUrlOrDefault(r *http.Request, defaultUrl string) string {
 	values := internalMiddleware.ExtractAllowedSearchParams(r.URL)
 	if requestedUrl := values.Get(internalMiddleware.RequestedURLParam); requestedUrl != "" {
@@ -3,8 +3,9 @@ package controller
 import (
 	"errors"
 	"fmt"
-	"github.com/emilhauk/chitchat/config"
 	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/emilhauk/chitchat/internal/sse"
 	"github.com/go-chi/chi/v5"
 	"net/http"
 )
@@ -12,10 +13,10 @@ import (
 func GetChannel(w http.ResponseWriter, r *http.Request) {
 	user := app.GetUserFromContextOrPanic(r.Context())
 	channelUUID := chi.URLParam(r, "channelUUID")
-	channel, err := chatService.GetChannel(channelUUID, user)
+	channel, err := chatService.GetChannel(channelUUID, r.URL.Query().Get("around"), user)
 
-	if channel.IsCurrentUserAdmin {
-		channel.InvitationURL = fmt.Sprintf("%s/join/%s", config.App.PublicURL, channel.UUID)
+	if err == nil && !channel.HasNewerMessages && len(channel.Messages) > 0 {
+		publishReadEvents(r, channel, channel.Messages[len(channel.Messages)-1], user)
 	}
 
 	if app.IsHtmxRequest(r) {
@@ -23,6 +24,8 @@ func GetChannel(w http.ResponseWriter, r *http.Request) {
 			switch {
 			case errors.Is(err, app.ErrChannelNotFound):
 				_ = tmpl.ExecuteTemplate(w, "error-main", map[string]any{"Code": 404, "Message": "Chat not found."})
+			case errors.Is(err, app.ErrMessageNotFound):
+				_ = tmpl.ExecuteTemplate(w, "error-main", map[string]any{"Code": 404, "Message": "Message not found."})
 			default:
 				log.Error().Err(err).Msgf("Failed to load channel=%s for user=%s", channelUUID, user.UUID)
 				_ = tmpl.ExecuteTemplate(w, "error-main", map[string]any{"Code": 500})
@@ -46,6 +49,8 @@ func GetChannel(w http.ResponseWriter, r *http.Request) {
 			switch {
 			case errors.Is(err, app.ErrChannelNotFound):
 				data["ErrorMain"] = map[string]any{"Code": 404, "Message": "Chat not found."}
+			case errors.Is(err, app.ErrMessageNotFound):
+				data["ErrorMain"] = map[string]any{"Code": 404, "Message": "Message not found."}
 			default:
 				log.Error().Err(err).Msgf("Failed to load channel=%s for user=%s", channelUUID, user.UUID)
 				data["ErrorMain"] = map[string]any{"Code": 500}
@@ -58,12 +63,44 @@ func GetChannel(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// MarkRead moves the user's read marker to the message, which the user has seen come in while viewing the channel.
+func MarkRead(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+
+	channel, err := channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	marked, err := chatService.MarkRead(channelUUID, messageUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	// Messages seen after a later one has been read leave the marker where it is
+	if marked {
+		publishReadEvents(r, channel, model.Message{UUID: messageUUID, ChannelUUID: channelUUID}, user)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishReadEvents has the user's channel list updated, now that the channel has been read up to the message, and
+// moves the user's read receipt to the message for the other members viewing the channel.
+func publishReadEvents(r *http.Request, channel model.Channel, message model.Message, user model.User) {
+	err := sse.MarkedReadUsingBrokerInContext(r.Context(), channel, message, user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to publish %s event", sse.EventReceipt)
+	}
+}
+
 func NewChannelForm(w http.ResponseWriter, r *http.Request) {
 	user := app.GetUserFromContextOrPanic(r.Context())
 	if app.IsHtmxRequest(r) {
 		_ = tmpl.ExecuteTemplate(w, "new-channel-form", map[string]any{})
 	} else {
-		channels, listErr := channelManager.GetChannelListForUser(user.UUID)
+		channels, listErr := chatService.GetChannelList(user)
 		data := map[string]any{
 			"User":               user,
 			"Channels":           channels,
@@ -93,3 +130,36 @@ func CreateNewChannel(w http.ResponseWriter, r *http.Request) {
 	}
 	app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channel.UUID))
 }
+
+func ArchiveChannel(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channel, err := chatService.ArchiveChannel(chi.URLParam(r, "channelUUID"), user)
+	respondWithArchivedState(w, r, channel, err, user)
+}
+
+func UnarchiveChannel(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channel, err := chatService.UnarchiveChannel(chi.URLParam(r, "channelUUID"), user)
+	respondWithArchivedState(w, r, channel, err, user)
+}
+
+// respondWithArchivedState has the channel, archived or brought back, shown anew to the user, and updated for the other
+// members.
+func respondWithArchivedState(w http.ResponseWriter, r *http.Request, channel model.Channel, err error, user model.User) {
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	publishSettingsEvent(r, channel, user)
+	app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channel.UUID))
+}
+
+// publishSettingsEvent updates the channel lists of the members, and the headers of those viewing the channel.
+func publishSettingsEvent(r *http.Request, channel model.Channel, user model.User) {
+	go func() {
+		err := sse.PublishUsingBrokerInContext(r.Context(), sse.NewEvent(sse.EventSettings, channel, model.Message{}, user.UUID))
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to publish %s event", sse.EventSettings)
+		}
+	}()
+}
@@ -18,6 +18,7 @@ var (
 	messageManager  manager.Message
 	chatService     service.Chat
 	registerService service.Register
+	searchService   service.Search
 )
 
 func ProvideManagers(um manager.User, sm manager.Session, cm manager.Channel, mm manager.Message) {
@@ -27,7 +28,8 @@ func ProvideManagers(um manager.User, sm manager.Session, cm manager.Channel, mm
 	messageManager = mm
 }
 
-func ProvideServices(cs service.Chat, rs service.Register) {
+func ProvideServices(cs service.Chat, rs service.Register, ss service.Search) {
 	chatService = cs
 	registerService = rs
+	searchService = ss
 }
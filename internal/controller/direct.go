@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// StartDirectConversation takes the user to the direct channel with another user, which is created if needed.
+func StartDirectConversation(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	otherUUID := chi.URLParam(r, "userUUID")
+
+	channel, err := chatService.StartDirectConversation(otherUUID, user)
+	if err != nil {
+		if errors.Is(err, app.ErrUserNotFound) {
+			app.Redirect(w, r, "/error/bad-request")
+			return
+		}
+		log.Error().Err(err).Msgf("Failed to start direct conversation between user=%s and user=%s", user.UUID, otherUUID)
+		app.Redirect(w, r, "/error/internal-server-error")
+		return
+	}
+	app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channel.UUID))
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"fmt"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+func GetDirectory(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	directory, err := chatService.GetDirectory(user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to get directory for user=%s", user.UUID)
+		app.Redirect(w, r, "/error/internal-server-error")
+		return
+	}
+
+	if app.IsHtmxRequest(r) {
+		_ = tmpl.ExecuteTemplate(w, "directory", directory)
+		return
+	}
+	channels, err := chatService.GetChannelList(user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to get channel list for user=%s", user.UUID)
+		app.Redirect(w, r, "/error/internal-server-error")
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "chat", map[string]any{
+		"User":          user,
+		"Channels":      channels,
+		"Directory":     directory,
+		"ShowDirectory": true,
+	})
+}
+
+func JoinChannel(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channel, err := chatService.JoinChannel(chi.URLParam(r, "channelUUID"), user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channel.UUID))
+}
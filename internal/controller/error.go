@@ -1,9 +1,45 @@
 package controller
 
 import (
+	"errors"
+	app "github.com/emilhauk/chitchat/internal"
 	"net/http"
 )
 
+// clientErrors are the errors caused by the request, rather than by chitchat failing to handle it.
+var clientErrors = []error{
+	app.ErrChannelNotFound,
+	app.ErrChannelArchived,
+	app.ErrChannelSettingsInvalid,
+	app.ErrMessageNotFound,
+	app.ErrMessageDeleted,
+	app.ErrMessageEditConflict,
+	app.ErrUnsupportedReaction,
+	app.ErrPermissionDenied,
+	app.ErrAttachmentNotFound,
+	app.ErrAttachmentTooLarge,
+	app.ErrUnsupportedImage,
+	app.ErrInvitationNotFound,
+	app.ErrMemberNotFound,
+	app.ErrLastOwner,
+	app.ErrUnsupportedRole,
+	app.ErrUnsupportedNotifyLevel,
+}
+
+// redirectOnError sends the user to the bad request page when the error is one of clientErrors, and to the internal
+// server error page otherwise.
+func redirectOnError(w http.ResponseWriter, r *http.Request, err error) {
+	for _, clientErr := range clientErrors {
+		if errors.Is(err, clientErr) {
+			log.Debug().Err(err).Msg("Rejected request")
+			app.Redirect(w, r, "/error/bad-request")
+			return
+		}
+	}
+	log.Error().Err(err).Msg("Failed to handle request")
+	app.Redirect(w, r, "/error/internal-server-error")
+}
+
 func InternalServerError(w http.ResponseWriter, r *http.Request) {
 	err := tmpl.ExecuteTemplate(w, "internal-server-error", map[string]any{})
 	if err != nil {
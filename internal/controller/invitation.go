@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/emilhauk/chitchat/config"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func GetInvitations(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	renderInvitations(w, r, channelUUID, user)
+}
+
+func CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	err := r.ParseForm()
+	if err != nil {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+	var expiresIn time.Duration
+	if value := r.FormValue("expires-in"); value != "" {
+		expiresIn, err = time.ParseDuration(value)
+		if err != nil || expiresIn < 0 {
+			app.Redirect(w, r, "/error/bad-request")
+			return
+		}
+	}
+	var maxUses int
+	if value := r.FormValue("max-uses"); value != "" {
+		maxUses, err = strconv.Atoi(value)
+		if err != nil || maxUses < 0 {
+			app.Redirect(w, r, "/error/bad-request")
+			return
+		}
+	}
+
+	_, err = chatService.CreateInvitation(channelUUID, expiresIn, maxUses, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	if app.IsHtmxRequest(r) {
+		renderInvitations(w, r, channelUUID, user)
+	} else {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s/invitations", channelUUID))
+	}
+}
+
+func RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	invitationCode := chi.URLParam(r, "invitationCode")
+
+	err := chatService.RevokeInvitation(channelUUID, invitationCode, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	if !app.IsHtmxRequest(r) {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s/invitations", channelUUID))
+	}
+}
+
+func renderInvitations(w http.ResponseWriter, r *http.Request, channelUUID string, user model.User) {
+	channel, err := channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	invitations, err := chatService.GetInvitations(channelUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	for i := range invitations {
+		invitations[i].URL = fmt.Sprintf("%s/join/%s", config.App.PublicURL, invitations[i].Code)
+	}
+	data := map[string]any{
+		"Channel":     channel,
+		"Invitations": invitations,
+	}
+
+	if app.IsHtmxRequest(r) {
+		_ = tmpl.ExecuteTemplate(w, "invitations", data)
+		return
+	}
+	channels, err := chatService.GetChannelList(user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to get channel list for user=%s", user.UUID)
+		app.Redirect(w, r, "/error/internal-server-error")
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "chat", map[string]any{
+		"User":        user,
+		"Channels":    channels,
+		"Invitations": data,
+	})
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	app "github.com/emilhauk/chitchat/internal"
 	"github.com/go-chi/chi/v5"
@@ -9,12 +10,30 @@ import (
 
 func Join(w http.ResponseWriter, r *http.Request) {
 	user := app.GetUserFromContextOrPanic(r.Context())
-	inviationCode := chi.URLParam(r, "invitationCode")
+	invitationCode := chi.URLParam(r, "invitationCode")
 
-	err := chatService.AcceptInvitation(inviationCode, user.UUID)
+	channel, err := chatService.AcceptInvitation(invitationCode, user)
 	if err != nil {
-		app.Redirect(w, r, "/error/internal-server-error")
+		if !errors.Is(err, app.ErrInvitationNotFound) && !errors.Is(err, app.ErrInvitationNotUsable) {
+			log.Error().Err(err).Msgf("Failed to accept invitation for user=%s", user.UUID)
+			app.Redirect(w, r, "/error/internal-server-error")
+			return
+		}
+		channels, listErr := chatService.GetChannelList(user)
+		if listErr != nil {
+			log.Error().Err(listErr).Msg("Failed to load channel list")
+			app.Redirect(w, r, "/error/internal-server-error")
+			return
+		}
+		_ = tmpl.ExecuteTemplate(w, "chat", map[string]any{
+			"User":     user,
+			"Channels": channels,
+			"ErrorMain": map[string]any{
+				"Code":    404,
+				"Message": "This invitation is not valid. It may have expired, been used up or revoked.",
+			},
+		})
 		return
 	}
-	app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", inviationCode))
+	app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channel.UUID))
 }
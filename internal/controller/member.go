@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/emilhauk/chitchat/internal/sse"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+func LeaveChannel(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+
+	channel, err := chatService.LeaveChannel(channelUUID, user)
+	if err != nil {
+		if errors.Is(err, app.ErrLastOwner) && app.IsHtmxRequest(r) {
+			_ = tmpl.ExecuteTemplate(w, "error-main", map[string]any{"Code": 400, "Message": "Make someone else an owner before leaving the channel."})
+			return
+		}
+		redirectOnError(w, r, err)
+		return
+	}
+	publishMembershipEvent(r, sse.EventRemoved, channel, user.UUID, user)
+	app.Redirect(w, r, "/im")
+}
+
+func RemoveMember(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	memberUUID := chi.URLParam(r, "userUUID")
+
+	channel, err := chatService.RemoveMember(channelUUID, memberUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	publishMembershipEvent(r, sse.EventRemoved, channel, memberUUID, user)
+	respondWithMembers(w, r, channelUUID, user)
+}
+
+func SetMemberRole(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	memberUUID := chi.URLParam(r, "userUUID")
+	err := r.ParseForm()
+	if err != nil {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+
+	channel, err := chatService.SetMemberRole(channelUUID, memberUUID, r.FormValue("role"), user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	publishMembershipEvent(r, sse.EventRole, channel, memberUUID, user)
+	respondWithMembers(w, r, channelUUID, user)
+}
+
+func respondWithMembers(w http.ResponseWriter, r *http.Request, channelUUID string, user model.User) {
+	if !app.IsHtmxRequest(r) {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
+		return
+	}
+	members, err := chatService.GetMembers(channelUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "channel-members", members)
+}
+
+// publishMembershipEvent tells the member that its membership of the channel has changed. A member removed from the
+// channel loses it from the channel list, and stops receiving its events. A member given a new role has its events
+// presented by that role from then on.
+func publishMembershipEvent(r *http.Request, eventType string, channel model.Channel, memberUUID string, user model.User) {
+	go func() {
+		event := sse.NewEvent(eventType, channel, model.Message{}, user.UUID)
+		event.NotifyUserUUIDs = []string{memberUUID}
+		err := sse.PublishUsingBrokerInContext(r.Context(), event)
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to publish %s event", eventType)
+		}
+	}()
+}
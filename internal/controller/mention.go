@@ -0,0 +1,33 @@
+package controller
+
+import (
+	app "github.com/emilhauk/chitchat/internal"
+	"net/http"
+)
+
+func GetMentions(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	mentions, err := chatService.GetMentions(user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to get mentions for user=%s", user.UUID)
+		app.Redirect(w, r, "/error/internal-server-error")
+		return
+	}
+
+	if app.IsHtmxRequest(r) {
+		_ = tmpl.ExecuteTemplate(w, "mentions", mentions)
+		return
+	}
+	channels, err := chatService.GetChannelList(user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to get channel list for user=%s", user.UUID)
+		app.Redirect(w, r, "/error/internal-server-error")
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "chat", map[string]any{
+		"User":         user,
+		"Channels":     channels,
+		"Mentions":     mentions,
+		"ShowMentions": true,
+	})
+}
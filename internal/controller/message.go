@@ -1,24 +1,32 @@
 package controller
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	app "github.com/emilhauk/chitchat/internal"
 	"github.com/emilhauk/chitchat/internal/model"
 	"github.com/emilhauk/chitchat/internal/sse"
 	"github.com/go-chi/chi/v5"
 	"net/http"
+	"strings"
 )
 
 func SendMessage(w http.ResponseWriter, r *http.Request) {
 	user := app.GetUserFromContextOrPanic(r.Context())
 	channelUUID := chi.URLParam(r, "channelUUID")
-	err := r.ParseForm()
+	uploads, err := parseMessageForm(w, r)
 	if err != nil {
+		log.Debug().Err(err).Msgf("Rejected message form from user=%s", user.UUID)
 		app.Redirect(w, r, "/error/bad-request")
 		return
 	}
+	defer removeUploads(r)
 	content := r.FormValue("message")
+	parentUUID := r.FormValue("parent-uuid")
+	if strings.TrimSpace(content) == "" && len(uploads) == 0 {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
 
 	channel, err := channelManager.GetChannelForUser(channelUUID, user.UUID)
 	if err != nil {
@@ -26,36 +34,299 @@ func SendMessage(w http.ResponseWriter, r *http.Request) {
 		app.Redirect(w, r, "/error/bad-request")
 		return
 	}
-	message, err := messageManager.Send(channel, model.Message{
-		Sender:  user,
-		Content: content,
-	})
+	if parentUUID != "" {
+		sendReply(w, r, channel, parentUUID, content, user, uploads)
+		return
+	}
+	message, err := chatService.SendMessage(channel, content, user, uploads...)
+	if errors.Is(err, app.ErrChannelArchived) {
+		respondChannelArchived(w, r, channel)
+		return
+	}
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+
+	publishMessageEvent(r, sse.EventMessage, channel, message, user)
+	publishMentionEvent(r, channel, message, message.Mentions, user)
+	stopTyping(r, channel, user)
+
+	if app.IsHtmxRequest(r) {
+		// Senders may always delete their own messages
+		message.IsDeletable = true
+		err = tmpl.ExecuteTemplate(w, "message", message)
+	} else {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
+	}
+}
+
+func sendReply(w http.ResponseWriter, r *http.Request, channel model.Channel, parentUUID, content string, user model.User, uploads []model.Upload) {
+	reply, parent, err := chatService.PostReply(channel, parentUUID, content, user, uploads...)
+	if errors.Is(err, app.ErrChannelArchived) {
+		respondChannelArchived(w, r, channel)
+		return
+	}
 	if err != nil {
-		log.Error().Err(err).Msgf("Failed to send message to channel=%s for user=%s", channelUUID, user.UUID)
+		redirectOnError(w, r, err)
+		return
+	}
 
-		// TODO Decide how to handle this scenario. Sending message failed
-		app.Redirect(w, r, "/error/internal-server-error")
+	publishMessageEvent(r, sse.EventMessage, channel, reply, user)
+	publishMessageEvent(r, sse.EventReplies, channel, parent, user)
+	publishMentionEvent(r, channel, reply, reply.Mentions, user)
+
+	if app.IsHtmxRequest(r) {
+		// Senders may always delete their own messages
+		reply.IsDeletable = true
+		_ = tmpl.ExecuteTemplate(w, "message", reply)
+	} else {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s/thread/%s", channel.UUID, parentUUID))
+	}
+}
+
+// Typing tells the others viewing the channel that the user is typing. Nothing is stored, and unless told again
+// shortly, the others will see the user stop typing.
+func Typing(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+
+	channel, err := chatService.GetChannelToPostTo(channelUUID, user)
+	if errors.Is(err, app.ErrChannelArchived) {
+		respondChannelArchived(w, r, channel)
 		return
 	}
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	err = sse.StartTypingUsingBrokerInContext(r.Context(), channel, user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to tell user=%s is typing in channel=%s", user.UUID, channelUUID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	go func(channel model.Channel, message model.Message) {
-		message.Direction = model.DirectionIn
+// respondChannelArchived tells the user that the channel is archived, in place of the write box the message was posted
+// from.
+func respondChannelArchived(w http.ResponseWriter, r *http.Request, channel model.Channel) {
+	if !app.IsHtmxRequest(r) {
+		redirectOnError(w, r, app.ErrChannelArchived)
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "channel-archived", channel)
+}
 
-		buf := bytes.Buffer{}
-		err = tmpl.ExecuteTemplate(&buf, "message", message)
+func stopTyping(r *http.Request, channel model.Channel, user model.User) {
+	go func() {
+		err := sse.StopTypingUsingBrokerInContext(r.Context(), channel, user)
 		if err != nil {
-			log.Error().Err(err).Msgf("Failed to execute template")
-			return
+			log.Error().Err(err).Msgf("Failed to tell user=%s stopped typing in channel=%s", user.UUID, channel.UUID)
 		}
-		err := sse.PublishUsingBrokerInContext(r.Context(), sse.NewEvent("message", channel, message, buf.String()))
+	}()
+}
+
+func GetMessages(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+
+	if !app.IsHtmxRequest(r) {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
+		return
+	}
+
+	query := r.URL.Query()
+	page, err := chatService.GetMessages(channelUUID, user, query.Get("before"), query.Get("after"))
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "message-page", page)
+}
+
+func GetMessage(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+
+	if !app.IsHtmxRequest(r) {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
+		return
+	}
+
+	message, err := chatService.GetMessage(channelUUID, messageUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "message-body", message)
+}
+
+func EditMessageForm(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+
+	if !app.IsHtmxRequest(r) {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
+		return
+	}
+
+	message, err := chatService.GetMessageToEdit(channelUUID, messageUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "message-edit-form", message)
+}
+
+func EditMessage(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+	err := r.ParseForm()
+	if err != nil {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+	content := r.FormValue("message")
+	if strings.TrimSpace(content) == "" {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+
+	channel, err := channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	message, addedMentions, err := chatService.EditMessage(channelUUID, messageUUID, content, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+
+	publishMessageEvent(r, sse.EventEdited, channel, message, user)
+	publishMentionEvent(r, channel, message, addedMentions, user)
+
+	if app.IsHtmxRequest(r) {
+		_ = tmpl.ExecuteTemplate(w, "message-body", message)
+	} else {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
+	}
+}
+
+func DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+
+	channel, err := channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	message, err := chatService.DeleteMessage(channelUUID, messageUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+
+	publishMessageEvent(r, sse.EventDeleted, channel, message, user)
+	if message.IsReply() {
+		// The reply count of the thread changed
+		parent, err := chatService.GetMessage(channelUUID, *message.ParentUUID, user)
 		if err != nil {
-			log.Error().Err(err).Msgf("Failed to publish message event")
+			log.Error().Err(err).Msgf("Failed to load thread=%s to publish its reply count", *message.ParentUUID)
+		} else {
+			publishMessageEvent(r, sse.EventReplies, channel, parent, user)
 		}
-	}(channel, message)
+	}
 
 	if app.IsHtmxRequest(r) {
-		err = tmpl.ExecuteTemplate(w, "message", message)
+		_ = tmpl.ExecuteTemplate(w, "message-body", message)
+		_ = tmpl.ExecuteTemplate(w, "message-unpinned", message)
 	} else {
 		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
 	}
 }
+
+func ToggleReaction(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+	err := r.ParseForm()
+	if err != nil {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+
+	channel, err := channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	message, err := chatService.ToggleReaction(channelUUID, messageUUID, r.FormValue("emoji"), user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+
+	publishMessageEvent(r, sse.EventReaction, channel, message, user)
+
+	if app.IsHtmxRequest(r) {
+		_ = tmpl.ExecuteTemplate(w, "message-reactions", message)
+	} else if message.IsReply() {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s/thread/%s", channelUUID, *message.ParentUUID))
+	} else {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
+	}
+}
+
+func GetMessageHistory(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+
+	if !app.IsHtmxRequest(r) {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
+		return
+	}
+
+	message, err := chatService.GetMessageHistory(channelUUID, messageUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "message-history", message)
+}
+
+func publishMessageEvent(r *http.Request, eventType string, channel model.Channel, message model.Message, user model.User) {
+	go func() {
+		err := sse.PublishUsingBrokerInContext(r.Context(), sse.NewEvent(eventType, channel, message, user.UUID))
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to publish %s event", eventType)
+		}
+	}()
+}
+
+// publishMentionEvent notifies the mentioned users, except the one mentioning them.
+func publishMentionEvent(r *http.Request, channel model.Channel, message model.Message, mentioned []model.User, user model.User) {
+	userUUIDs := make([]string, 0, len(mentioned))
+	for _, mentionedUser := range mentioned {
+		if mentionedUser.UUID != user.UUID {
+			userUUIDs = append(userUUIDs, mentionedUser.UUID)
+		}
+	}
+	if len(userUUIDs) == 0 {
+		return
+	}
+	go func() {
+		event := sse.NewEvent(sse.EventMention, channel, message, user.UUID)
+		event.NotifyUserUUIDs = userUUIDs
+		err := sse.PublishUsingBrokerInContext(r.Context(), event)
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to publish %s event", sse.EventMention)
+		}
+	}()
+}
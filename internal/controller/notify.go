@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"fmt"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/emilhauk/chitchat/internal/sse"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"time"
+)
+
+func SetNotifyLevel(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	err := r.ParseForm()
+	if err != nil {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+	var mutedUntil *time.Time
+	if value := r.FormValue("muted-for"); value != "" {
+		mutedFor, err := time.ParseDuration(value)
+		if err != nil || mutedFor <= 0 {
+			app.Redirect(w, r, "/error/bad-request")
+			return
+		}
+		until := time.Now().Add(mutedFor)
+		mutedUntil = &until
+	}
+
+	channel, err := chatService.SetNotifyLevel(channelUUID, r.FormValue("notify"), mutedUntil, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	publishOwnChannelListEvent(r, sse.EventNotify, channel, user)
+	if app.IsHtmxRequest(r) {
+		_ = tmpl.ExecuteTemplate(w, "channel-notify", channel)
+	} else {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
+	}
+}
+
+// publishOwnChannelListEvent has the user's own channel list refreshed, as nobody else's is affected.
+func publishOwnChannelListEvent(r *http.Request, eventType string, channel model.Channel, user model.User) {
+	go func() {
+		event := sse.NewEvent(eventType, channel, model.Message{}, user.UUID)
+		event.NotifyUserUUIDs = []string{user.UUID}
+		err := sse.PublishUsingBrokerInContext(r.Context(), event)
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to publish %s event", eventType)
+		}
+	}()
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"fmt"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/emilhauk/chitchat/internal/sse"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+func SetFavourite(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	err := r.ParseForm()
+	if err != nil {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+
+	channel, err := chatService.SetFavourite(channelUUID, r.FormValue("favourite") == "true", user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	publishOwnChannelListEvent(r, sse.EventOrder, channel, user)
+	if app.IsHtmxRequest(r) {
+		_ = tmpl.ExecuteTemplate(w, "channel-favourite", channel)
+	} else {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channelUUID))
+	}
+}
+
+// OrderChannelList places the user's channels in the order they were dragged into.
+func OrderChannelList(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	err := r.ParseForm()
+	if err != nil {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+
+	err = chatService.OrderChannelList(r.Form["channel"], user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	publishOwnChannelListEvent(r, sse.EventOrder, model.Channel{}, user)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"fmt"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/emilhauk/chitchat/internal/sse"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+func PinMessage(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+
+	channel, err := channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	message, pins, err := chatService.PinMessage(channelUUID, messageUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	respondWithPins(w, r, channel, message, pins, user)
+}
+
+func UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+
+	channel, err := channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	message, pins, err := chatService.UnpinMessage(channelUUID, messageUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	respondWithPins(w, r, channel, message, pins, user)
+}
+
+// respondWithPins has everyone viewing the channel see its pins updated, and responds with the same update.
+func respondWithPins(w http.ResponseWriter, r *http.Request, channel model.Channel, message model.Message, pins []model.Pin, user model.User) {
+	channel.Pins = pins
+	publishMessageEvent(r, sse.EventPin, channel, message, user)
+
+	if app.IsHtmxRequest(r) {
+		_ = tmpl.ExecuteTemplate(w, "channel-pins-update", map[string]any{
+			"Channel": channel,
+			"Message": message,
+		})
+	} else {
+		app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channel.UUID))
+	}
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/emilhauk/chitchat/config"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/qrcode"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"time"
+)
+
+// qrCodeScale is the number of pixels to each module of QR codes served as PNG
+const qrCodeScale = 8
+
+// GetInvitationQRCode serves the link to the invitation as a QR code, as PNG unless the format=svg query parameter is
+// given. Only those who may invite others to the channel may see it.
+func GetInvitationQRCode(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	invitationCode := chi.URLParam(r, "invitationCode")
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := chatService.GetInvitation(invitationCode, user)
+	if err != nil {
+		if errors.Is(err, app.ErrInvitationNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Error().Err(err).Msgf("Failed to load invitation for user=%s", user.UUID)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	code, err := qrcode.Encode(fmt.Sprintf("%s/join/%s", config.App.PublicURL, invitation.Code))
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to encode QR code for invitation to channel=%s", invitation.ChannelUUID)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	var content bytes.Buffer
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = code.SVG(&content)
+	} else {
+		w.Header().Set("Content-Type", "image/png")
+		err = code.PNG(&content, qrCodeScale)
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to draw QR code for invitation to channel=%s", invitation.ChannelUUID)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	// The code never changes for an invitation, but is only for those who may invite others to see
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%s"`, invitation.Code, format))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content.Bytes()))
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"errors"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/emilhauk/chitchat/internal/service"
+	"net/http"
+	"time"
+)
+
+func Search(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	params := r.URL.Query()
+	query := model.SearchQuery{
+		Text:        params.Get("q"),
+		ChannelUUID: params.Get("channel"),
+		SenderUUID:  params.Get("sender"),
+	}
+	var err error
+	query.From, err = parseDate(params.Get("from"))
+	if err != nil {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+	query.To, err = parseDate(params.Get("to"))
+	if err != nil {
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+
+	channels, err := searchService.GetChannels(user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to load channels to search for user=%s", user.UUID)
+		app.Redirect(w, r, "/error/internal-server-error")
+		return
+	}
+	senders, err := searchService.GetSenders(user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to load senders to search for user=%s", user.UUID)
+		app.Redirect(w, r, "/error/internal-server-error")
+		return
+	}
+	search := map[string]any{
+		"Query":    query,
+		"Channels": channels,
+		"Senders":  senders,
+	}
+	if query.Text != "" {
+		var results service.SearchResults
+		results, err = searchService.SearchMessages(query, user)
+		switch {
+		case errors.Is(err, app.ErrSearchTooShort):
+			search["TooShort"] = true
+		case err != nil:
+			log.Error().Err(err).Msgf("Failed to search messages for user=%s", user.UUID)
+			app.Redirect(w, r, "/error/internal-server-error")
+			return
+		default:
+			search["Results"] = results.Results
+			search["HasMore"] = results.HasMore
+			search["IsSearched"] = true
+		}
+	}
+
+	if app.IsHtmxRequest(r) {
+		_ = tmpl.ExecuteTemplate(w, "search", search)
+		return
+	}
+	channelList, err := chatService.GetChannelList(user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to get channel list for user=%s", user.UUID)
+		app.Redirect(w, r, "/error/internal-server-error")
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "chat", map[string]any{
+		"User":       user,
+		"Channels":   channelList,
+		"Search":     search,
+		"ShowSearch": true,
+	})
+}
+
+// parseDate parses a date as given by a date input. Nothing is returned for an empty value.
+func parseDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/emilhauk/chitchat/config"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func GetChannelSettings(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	channel, err := chatService.GetChannelToEdit(channelUUID, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+
+	if app.IsHtmxRequest(r) {
+		_ = tmpl.ExecuteTemplate(w, "channel-settings", channel)
+		return
+	}
+	channels, err := chatService.GetChannelList(user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to get channel list for user=%s", user.UUID)
+		app.Redirect(w, r, "/error/internal-server-error")
+		return
+	}
+	_ = tmpl.ExecuteTemplate(w, "chat", map[string]any{
+		"User":     user,
+		"Channels": channels,
+		"Settings": channel,
+	})
+}
+
+func UpdateChannelSettings(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	settings, err := parseChannelSettingsForm(w, r)
+	defer removeUploads(r)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Rejected settings of channel=%s from user=%s", channelUUID, user.UUID)
+		app.Redirect(w, r, "/error/bad-request")
+		return
+	}
+
+	channel, err := chatService.UpdateChannel(channelUUID, settings, user)
+	if err != nil {
+		redirectOnError(w, r, err)
+		return
+	}
+	publishSettingsEvent(r, channel, user)
+	app.Redirect(w, r, fmt.Sprintf("/im/channel/%s", channel.UUID))
+}
+
+// parseChannelSettingsForm parses the settings form, which is multipart as it may carry an avatar. The avatar must be
+// removed with removeUploads once handled.
+func parseChannelSettingsForm(w http.ResponseWriter, r *http.Request) (model.ChannelSettings, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, config.Storage.MaxAttachmentSize+1<<20)
+	err := r.ParseMultipartForm(maxMessageFormMemory)
+	if errors.Is(err, http.ErrNotMultipart) {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		return model.ChannelSettings{}, err
+	}
+	settings := model.ChannelSettings{
+		Name:         strings.TrimSpace(r.FormValue("name")),
+		Topic:        strings.TrimSpace(r.FormValue("topic")),
+		Description:  strings.TrimSpace(r.FormValue("description")),
+		Visibility:   r.FormValue("visibility"),
+		RemoveAvatar: r.FormValue("remove-avatar") != "",
+	}
+	if r.MultipartForm == nil {
+		return settings, nil
+	}
+	for _, header := range r.MultipartForm.File["avatar"] {
+		// Browsers send an empty part when no file is chosen
+		if header.Filename == "" && header.Size == 0 {
+			continue
+		}
+		if header.Size > config.Storage.MaxAttachmentSize {
+			return settings, app.ErrAttachmentTooLarge
+		}
+		file, err := header.Open()
+		if err != nil {
+			return settings, err
+		}
+		settings.Avatar = &model.Upload{
+			FileName: header.Filename,
+			Size:     header.Size,
+			Content:  file,
+		}
+	}
+	return settings, nil
+}
+
+func GetChannelAvatar(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+
+	content, err := chatService.GetChannelAvatar(channelUUID, user)
+	if err != nil {
+		if errors.Is(err, app.ErrAvatarNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Error().Err(err).Msgf("Failed to load avatar of channel=%s for user=%s", channelUUID, user.UUID)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// A new avatar is served from a new URL, but avatars are only for members to see
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	_, err = io.Copy(w, content)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to send avatar of channel=%s to user=%s", channelUUID, user.UUID)
+	}
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"errors"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+func GetThread(w http.ResponseWriter, r *http.Request) {
+	user := app.GetUserFromContextOrPanic(r.Context())
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+	thread, err := chatService.GetThread(channelUUID, messageUUID, user)
+
+	if app.IsHtmxRequest(r) {
+		if err != nil {
+			switch {
+			case errors.Is(err, app.ErrChannelNotFound):
+				_ = tmpl.ExecuteTemplate(w, "error-main", map[string]any{"Code": 404, "Message": "Chat not found."})
+			case errors.Is(err, app.ErrMessageNotFound):
+				_ = tmpl.ExecuteTemplate(w, "error-main", map[string]any{"Code": 404, "Message": "Thread not found."})
+			default:
+				log.Error().Err(err).Msgf("Failed to load thread=%s in channel=%s for user=%s", messageUUID, channelUUID, user.UUID)
+				_ = tmpl.ExecuteTemplate(w, "error-main", map[string]any{"Code": 500})
+			}
+			return
+		}
+		_ = tmpl.ExecuteTemplate(w, "thread", thread)
+	} else {
+		channels, listErr := chatService.GetChannelList(user)
+		data := map[string]any{
+			"User":     user,
+			"Channels": channels,
+			"Thread":   thread,
+		}
+		if listErr != nil {
+			log.Error().Err(listErr).Msg("Failed to load channel list")
+			app.Redirect(w, r, "/error/internal-server-error")
+			return
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, app.ErrChannelNotFound):
+				data["ErrorMain"] = map[string]any{"Code": 404, "Message": "Chat not found."}
+			case errors.Is(err, app.ErrMessageNotFound):
+				data["ErrorMain"] = map[string]any{"Code": 404, "Message": "Thread not found."}
+			default:
+				log.Error().Err(err).Msgf("Failed to load thread=%s in channel=%s for user=%s", messageUUID, channelUUID, user.UUID)
+				data["ErrorMain"] = map[string]any{"Code": 500}
+			}
+		}
+		err = tmpl.ExecuteTemplate(w, "chat", data)
+		if err != nil {
+			log.Warn().Err(err).Send()
+		}
+	}
+}
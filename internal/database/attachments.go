@@ -0,0 +1,96 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type Attachments struct {
+	db *sql.DB
+
+	findByUUID         *sql.Stmt
+	findForMessagesSQL string
+}
+
+func NewAttachmentStore(db *sql.DB) Attachments {
+	findByUUID, err := db.Prepare("SELECT uuid, message_uuid, channel_uuid, file_name, content_type, size, storage_key, thumbnail_key, created_at FROM message_attachments WHERE uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_attachments.findByUUID")
+	}
+	findForMessagesSQL := "SELECT uuid, message_uuid, channel_uuid, file_name, content_type, size, storage_key, thumbnail_key, created_at FROM message_attachments WHERE message_uuid IN (?) ORDER BY created_at, file_name"
+	_, err = db.Prepare(findForMessagesSQL)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_attachments.findForMessages")
+	}
+
+	return Attachments{
+		db:                 db,
+		findByUUID:         findByUUID,
+		findForMessagesSQL: findForMessagesSQL,
+	}
+}
+
+func (s Attachments) FindByUUID(uuid string) (model.Attachment, error) {
+	attachment, err := s.mapToAttachment(s.findByUUID.QueryRow(uuid))
+	if errors.Is(err, sql.ErrNoRows) {
+		return attachment, app.ErrAttachmentNotFound
+	}
+	return attachment, err
+}
+
+func (s Attachments) FindForMessages(messageUUIDs ...string) ([]model.Attachment, error) {
+	attachments := make([]model.Attachment, 0)
+	if len(messageUUIDs) == 0 {
+		return attachments, nil
+	}
+	query, args, err := sqlx.In(s.findForMessagesSQL, messageUUIDs)
+	if err != nil {
+		return attachments, err
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return attachments, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		attachment, err := s.mapToAttachment(rows)
+		if err != nil {
+			return attachments, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+func (s Attachments) mapToAttachment(row interface{ Scan(...any) error }) (model.Attachment, error) {
+	var (
+		uuid         string
+		messageUUID  string
+		channelUUID  string
+		fileName     string
+		contentType  string
+		size         int64
+		storageKey   string
+		thumbnailKey sql.NullString
+		createdAt    time.Time
+	)
+	err := row.Scan(&uuid, &messageUUID, &channelUUID, &fileName, &contentType, &size, &storageKey, &thumbnailKey, &createdAt)
+	attachment := model.Attachment{
+		UUID:        uuid,
+		MessageUUID: messageUUID,
+		ChannelUUID: channelUUID,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        size,
+		StorageKey:  storageKey,
+		CreatedAt:   createdAt,
+	}
+	if thumbnailKey.Valid {
+		attachment.ThumbnailKey = &thumbnailKey.String
+	}
+	return attachment, err
+}
@@ -5,35 +5,69 @@ import (
 	"errors"
 	"github.com/emilhauk/chitchat/internal"
 	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/jmoiron/sqlx"
 	"time"
 )
 
 type Channels struct {
 	db *sql.DB
 
-	create         *sql.Stmt
-	findByUUID     *sql.Stmt
-	findForUser    *sql.Stmt
-	findAllForUser *sql.Stmt
+	create          *sql.Stmt
+	update          *sql.Stmt
+	setArchivedAt   *sql.Stmt
+	findByUUID      *sql.Stmt
+	findByDirectKey *sql.Stmt
+	findForUser     *sql.Stmt
+	findAllForUser  *sql.Stmt
+	findPublic      *sql.Stmt
 
-	addMember  *sql.Stmt
-	findMember *sql.Stmt
+	addMember       *sql.Stmt
+	findMember      *sql.Stmt
+	findMembers     *sql.Stmt
+	findMemberships *sql.Stmt
+	lockMembers     *sql.Stmt
+	removeMember    *sql.Stmt
+	setRole         *sql.Stmt
+	setNotify       *sql.Stmt
+	setFavourite    *sql.Stmt
+	setSortOrder    *sql.Stmt
+	markRead        *sql.Stmt
+
+	countMembersOfChannelsSQL    string
+	findMemberUUIDsOfChannelsSQL string
+	findContacts                 *sql.Stmt
 }
 
 func NewChannelStore(db *sql.DB) Channels {
-	create, err := db.Prepare("INSERT INTO channels (uuid, name, created_at) VALUE (?, ?, ?)")
+	create, err := db.Prepare("INSERT INTO channels (uuid, name, kind, direct_key, created_at) VALUE (?, ?, ?, ?, ?)")
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for channels.create")
 	}
-	findByUUID, err := db.Prepare("SELECT uuid, name, created_at, updated_at FROM channels WHERE uuid = ?")
+	update, err := db.Prepare("UPDATE channels SET name = ?, topic = ?, description = ?, avatar_key = ?, visibility = ?, updated_at = ? WHERE uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channels.update")
+	}
+	setArchivedAt, err := db.Prepare("UPDATE channels SET archived_at = ?, updated_at = ? WHERE uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channels.setArchivedAt")
+	}
+	findByUUID, err := db.Prepare("SELECT uuid, name, topic, description, avatar_key, kind, visibility, created_at, updated_at, archived_at FROM channels WHERE uuid = ?")
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for channels.findByUUID")
 	}
-	findForUser, err := db.Prepare("SELECT c.uuid, c.name, c.created_at, c.updated_at FROM channels c INNER JOIN channel_members cm ON c.uuid = cm.channel_uuid WHERE c.uuid = ? AND cm.user_uuid = ?")
+	findByDirectKey, err := db.Prepare("SELECT uuid, name, topic, description, avatar_key, kind, visibility, created_at, updated_at, archived_at FROM channels WHERE direct_key = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channels.findByDirectKey")
+	}
+	findForUser, err := db.Prepare("SELECT c.uuid, c.name, c.topic, c.description, c.avatar_key, c.kind, c.visibility, c.created_at, c.updated_at, c.archived_at FROM channels c INNER JOIN channel_members cm ON c.uuid = cm.channel_uuid WHERE c.uuid = ? AND cm.user_uuid = ?")
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for channels.findForUser")
 	}
-	findAllForUser, err := db.Prepare("SELECT c.uuid, c.name, c.created_at, c.updated_at FROM channels c INNER JOIN channel_members cm ON c.uuid = cm.channel_uuid WHERE cm.user_uuid = ?")
+	findPublic, err := db.Prepare("SELECT uuid, name, topic, description, avatar_key, kind, visibility, created_at, updated_at, archived_at FROM channels WHERE visibility = 'public' AND kind = 'group' AND archived_at IS NULL ORDER BY name")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channels.findPublic")
+	}
+	findAllForUser, err := db.Prepare("SELECT c.uuid, c.name, c.topic, c.description, c.avatar_key, c.kind, c.visibility, c.created_at, c.updated_at, c.archived_at FROM channels c INNER JOIN channel_members cm ON c.uuid = cm.channel_uuid WHERE cm.user_uuid = ?")
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for channels.findAllForUser")
 	}
@@ -42,24 +76,136 @@ func NewChannelStore(db *sql.DB) Channels {
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.addMember")
 	}
-	findMember, err := db.Prepare("SELECT * FROM channel_members WHERE channel_uuid = ? AND user_uuid = ?")
+	findMember, err := db.Prepare("SELECT channel_uuid, user_uuid, role, notify, muted_until, is_favourite, sort_order, last_read_message_uuid, last_read_at, created_at, updated_at FROM channel_members WHERE channel_uuid = ? AND user_uuid = ?")
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.findMember")
 	}
+	findMembers, err := db.Prepare("SELECT channel_uuid, user_uuid, role, notify, muted_until, is_favourite, sort_order, last_read_message_uuid, last_read_at, created_at, updated_at FROM channel_members WHERE channel_uuid = ? ORDER BY created_at")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.findMembers")
+	}
+	findMemberships, err := db.Prepare("SELECT channel_uuid, user_uuid, role, notify, muted_until, is_favourite, sort_order, last_read_message_uuid, last_read_at, created_at, updated_at FROM channel_members WHERE user_uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.findMemberships")
+	}
+	lockMembers, err := db.Prepare("SELECT user_uuid, role FROM channel_members WHERE channel_uuid = ? FOR UPDATE")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.lockMembers")
+	}
+	removeMember, err := db.Prepare("DELETE FROM channel_members WHERE channel_uuid = ? AND user_uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.removeMember")
+	}
+	setRole, err := db.Prepare("UPDATE channel_members SET role = ?, updated_at = ? WHERE channel_uuid = ? AND user_uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.setRole")
+	}
+	// The read marker only ever moves forward, ordered the same way as channel history
+	markRead, err := db.Prepare("UPDATE channel_members cm INNER JOIN messages m ON m.uuid = ? AND m.channel_uuid = cm.channel_uuid SET cm.last_read_message_uuid = m.uuid, cm.last_read_at = m.sent_at WHERE cm.channel_uuid = ? AND cm.user_uuid = ? AND (cm.last_read_at IS NULL OR cm.last_read_at < m.sent_at OR (cm.last_read_at = m.sent_at AND cm.last_read_message_uuid < m.uuid))")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.markRead")
+	}
+	setNotify, err := db.Prepare("UPDATE channel_members SET notify = ?, muted_until = ?, updated_at = ? WHERE channel_uuid = ? AND user_uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.setNotify")
+	}
+	setFavourite, err := db.Prepare("UPDATE channel_members SET is_favourite = ?, updated_at = ? WHERE channel_uuid = ? AND user_uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.setFavourite")
+	}
+	setSortOrder, err := db.Prepare("UPDATE channel_members SET sort_order = ? WHERE channel_uuid = ? AND user_uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.setSortOrder")
+	}
+
+	countMembersOfChannelsSQL := "SELECT channel_uuid, COUNT(*) FROM channel_members WHERE channel_uuid IN (?) GROUP BY channel_uuid"
+	_, err = db.Prepare(countMembersOfChannelsSQL)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.countMembersOfChannels")
+	}
+	findMemberUUIDsOfChannelsSQL := "SELECT channel_uuid, user_uuid FROM channel_members WHERE channel_uuid IN (?)"
+	_, err = db.Prepare(findMemberUUIDsOfChannelsSQL)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.findMemberUUIDsOfChannels")
+	}
+	// Contacts are everyone sharing at least one channel with the user, the user included
+	findContacts, err := db.Prepare("SELECT DISTINCT other.user_uuid FROM channel_members cm INNER JOIN channel_members other ON other.channel_uuid = cm.channel_uuid WHERE cm.user_uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_members.findContacts")
+	}
 
 	return Channels{
-		db:             db,
-		create:         create,
-		findByUUID:     findByUUID,
-		findForUser:    findForUser,
-		findAllForUser: findAllForUser,
-		addMember:      addMember,
-		findMember:     findMember,
+		db:              db,
+		create:          create,
+		update:          update,
+		setArchivedAt:   setArchivedAt,
+		findByUUID:      findByUUID,
+		findByDirectKey: findByDirectKey,
+		findForUser:     findForUser,
+		findAllForUser:  findAllForUser,
+		findPublic:      findPublic,
+		addMember:       addMember,
+		findMember:      findMember,
+		findMembers:     findMembers,
+		findMemberships: findMemberships,
+		lockMembers:     lockMembers,
+		removeMember:    removeMember,
+		setRole:         setRole,
+		setNotify:       setNotify,
+		setFavourite:    setFavourite,
+		setSortOrder:    setSortOrder,
+		markRead:        markRead,
+
+		countMembersOfChannelsSQL:    countMembersOfChannelsSQL,
+		findMemberUUIDsOfChannelsSQL: findMemberUUIDsOfChannelsSQL,
+		findContacts:                 findContacts,
 	}
 }
 
 func (s Channels) Create(m model.Channel) error {
-	_, err := s.create.Exec(m.UUID, m.Name, m.CreatedAt)
+	_, err := s.create.Exec(m.UUID, m.Name, m.Kind, directKeyOf(m), m.CreatedAt)
+	return err
+}
+
+// CreateWithMembers creates the channel along with the users' memberships, all given the role. Either all of it is
+// created, or none of it.
+func (s Channels) CreateWithMembers(m model.Channel, role model.ChannelRole, users ...model.User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Stmt(s.create).Exec(m.UUID, m.Name, m.Kind, directKeyOf(m), m.CreatedAt)
+	for _, user := range users {
+		if err != nil {
+			break
+		}
+		_, err = tx.Stmt(s.addMember).Exec(m.UUID, user.UUID, role, m.CreatedAt)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// directKeyOf returns the key telling direct channels apart by their users, and nil for other channels.
+func directKeyOf(m model.Channel) *string {
+	if !m.IsDirect() {
+		return nil
+	}
+	key := model.DirectKey(m.DirectUserUUIDs...)
+	return &key
+}
+
+// Update stores the channel's settings.
+func (s Channels) Update(m model.Channel) error {
+	_, err := s.update.Exec(m.Name, m.Topic, m.Description, m.AvatarKey, m.Visibility, m.UpdatedAt, m.UUID)
+	return err
+}
+
+// SetArchivedAt archives the channel, or brings it back if archivedAt is nil.
+func (s Channels) SetArchivedAt(m model.Channel) error {
+	_, err := s.setArchivedAt.Exec(m.ArchivedAt, m.UpdatedAt, m.UUID)
 	return err
 }
 
@@ -71,6 +217,15 @@ func (s Channels) FindByUUID(uuid string) (model.Channel, error) {
 	return channel, err
 }
 
+// FindDirect returns the direct channel between the users.
+func (s Channels) FindDirect(userUUIDs ...string) (model.Channel, error) {
+	channel, err := s.mapToChannel(s.findByDirectKey.QueryRow(model.DirectKey(userUUIDs...)))
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return channel, app.ErrChannelNotFound
+	}
+	return channel, err
+}
+
 func (s Channels) FindForUser(channelUUID, userUUID string) (model.Channel, error) {
 	channel, err := s.mapToChannel(s.findForUser.QueryRow(channelUUID, userUUID))
 	if err != nil && errors.Is(err, sql.ErrNoRows) {
@@ -111,45 +266,324 @@ func (s Channels) FindMember(channelUUID, userUUID string) (model.Member, error)
 	return member, err
 }
 
+func (s Channels) FindMembers(channelUUID string) ([]model.Member, error) {
+	members := make([]model.Member, 0)
+	rows, err := s.findMembers.Query(channelUUID)
+	if err != nil {
+		return members, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		member, err := s.mapToMember(rows)
+		if err != nil {
+			return members, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// RemoveMember takes the user out of the channel. The last owner may only leave when nobody else is left.
+func (s Channels) RemoveMember(channelUUID, userUUID string) error {
+	return s.changeMember(channelUUID, userUUID, func(tx *sql.Tx, roles map[string]model.ChannelRole) error {
+		if len(roles) > 1 {
+			if err := requireOtherOwner(roles, userUUID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Stmt(s.removeMember).Exec(channelUUID, userUUID)
+		return err
+	})
+}
+
+// SetRole gives the member a new role. The last owner of the channel may not give up the role.
+func (s Channels) SetRole(channelUUID, userUUID string, role model.ChannelRole) error {
+	return s.changeMember(channelUUID, userUUID, func(tx *sql.Tx, roles map[string]model.ChannelRole) error {
+		if role != model.RoleOwner {
+			if err := requireOtherOwner(roles, userUUID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Stmt(s.setRole).Exec(role, time.Now(), channelUUID, userUUID)
+		return err
+	})
+}
+
+// SetNotify sets what the member is notified of in the channel, and until when a muted member is muted.
+func (s Channels) SetNotify(channelUUID, userUUID string, notify model.NotifyLevel, mutedUntil *time.Time) error {
+	_, err := s.setNotify.Exec(notify, mutedUntil, time.Now(), channelUUID, userUUID)
+	return err
+}
+
+func (s Channels) SetFavourite(channelUUID, userUUID string, isFavourite bool) error {
+	_, err := s.setFavourite.Exec(isFavourite, time.Now(), channelUUID, userUUID)
+	return err
+}
+
+// SetSortOrder orders the user's channels as given. Channels the user isn't a member of are left out.
+func (s Channels) SetSortOrder(userUUID string, channelUUIDs []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for i, channelUUID := range channelUUIDs {
+		_, err = tx.Stmt(s.setSortOrder).Exec(i, channelUUID, userUUID)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// changeMember runs change in a transaction, given the roles of everyone in the channel. Their memberships are locked
+// meanwhile, so that concurrent changes can't leave the channel without an owner.
+func (s Channels) changeMember(channelUUID, userUUID string, change func(tx *sql.Tx, roles map[string]model.ChannelRole) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	roles, err := lockRoles(tx.Stmt(s.lockMembers), channelUUID)
+	if err == nil {
+		if _, found := roles[userUUID]; !found {
+			err = app.ErrMemberNotFound
+		}
+	}
+	if err == nil {
+		err = change(tx, roles)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func lockRoles(stmt *sql.Stmt, channelUUID string) (map[string]model.ChannelRole, error) {
+	roles := make(map[string]model.ChannelRole)
+	rows, err := stmt.Query(channelUUID)
+	if err != nil {
+		return roles, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			userUUID string
+			role     model.ChannelRole
+		)
+		if err = rows.Scan(&userUUID, &role); err != nil {
+			return roles, err
+		}
+		roles[userUUID] = role
+	}
+	return roles, rows.Err()
+}
+
+// requireOtherOwner fails with app.ErrLastOwner when the user is the only owner among roles.
+func requireOtherOwner(roles map[string]model.ChannelRole, userUUID string) error {
+	if roles[userUUID] != model.RoleOwner {
+		return nil
+	}
+	for otherUUID, role := range roles {
+		if otherUUID != userUUID && role == model.RoleOwner {
+			return nil
+		}
+	}
+	return app.ErrLastOwner
+}
+
+// CountMembersOfChannels returns the number of members of each of the channels, by channel UUID.
+func (s Channels) CountMembersOfChannels(channelUUIDs ...string) (map[string]int, error) {
+	counts := map[string]int{}
+	if len(channelUUIDs) == 0 {
+		return counts, nil
+	}
+	query, args, err := sqlx.In(s.countMembersOfChannelsSQL, channelUUIDs)
+	if err != nil {
+		return counts, err
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var channelUUID string
+		var count int
+		if err = rows.Scan(&channelUUID, &count); err != nil {
+			return counts, err
+		}
+		counts[channelUUID] = count
+	}
+	return counts, nil
+}
+
+// FindMemberships returns the user's membership of each of the user's channels, by channel UUID.
+func (s Channels) FindMemberships(userUUID string) (map[string]model.Member, error) {
+	members := map[string]model.Member{}
+	rows, err := s.findMemberships.Query(userUUID)
+	if err != nil {
+		return members, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		member, err := s.mapToMember(rows)
+		if err != nil {
+			return members, err
+		}
+		members[member.ChannelUUID] = member
+	}
+	return members, nil
+}
+
+// FindMemberUUIDsOfChannels returns the UUIDs of the users who are members of each of the channels, by channel UUID.
+func (s Channels) FindMemberUUIDsOfChannels(channelUUIDs ...string) (map[string][]string, error) {
+	userUUIDs := map[string][]string{}
+	if len(channelUUIDs) == 0 {
+		return userUUIDs, nil
+	}
+	query, args, err := sqlx.In(s.findMemberUUIDsOfChannelsSQL, channelUUIDs)
+	if err != nil {
+		return userUUIDs, err
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return userUUIDs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var channelUUID, userUUID string
+		if err = rows.Scan(&channelUUID, &userUUID); err != nil {
+			return userUUIDs, err
+		}
+		userUUIDs[channelUUID] = append(userUUIDs[channelUUID], userUUID)
+	}
+	return userUUIDs, nil
+}
+
+// FindPublic finds the channels anyone may join, unless archived, ordered by name.
+func (s Channels) FindPublic() ([]model.Channel, error) {
+	channels := make([]model.Channel, 0)
+	rows, err := s.findPublic.Query()
+	if err != nil {
+		return channels, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		channel, err := s.mapToChannel(rows)
+		if err != nil {
+			return channels, err
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+// FindContacts returns the UUIDs of the users sharing a channel with the user, including the user itself.
+func (s Channels) FindContacts(userUUID string) ([]string, error) {
+	userUUIDs := make([]string, 0)
+	rows, err := s.findContacts.Query(userUUID)
+	if err != nil {
+		return userUUIDs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var contactUUID string
+		if err = rows.Scan(&contactUUID); err != nil {
+			return userUUIDs, err
+		}
+		userUUIDs = append(userUUIDs, contactUUID)
+	}
+	return userUUIDs, nil
+}
+
+// MarkRead moves the member's read marker to the message, unless the marker is already past it, and tells whether the
+// marker moved.
+func (s Channels) MarkRead(channelUUID, userUUID, messageUUID string) (bool, error) {
+	result, err := s.markRead.Exec(messageUUID, channelUUID, userUUID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
 func (s Channels) mapToChannel(row interface{ Scan(...any) error }) (model.Channel, error) {
 	var (
-		uuid      string
-		name      sql.NullString
-		createdAt time.Time
-		updatedAt sql.NullTime
+		uuid        string
+		name        sql.NullString
+		topic       sql.NullString
+		description sql.NullString
+		avatarKey   sql.NullString
+		kind        model.ChannelKind
+		visibility  model.ChannelVisibility
+		createdAt   time.Time
+		updatedAt   sql.NullTime
+		archivedAt  sql.NullTime
 	)
 
-	err := row.Scan(&uuid, &name, &createdAt, &updatedAt)
+	err := row.Scan(&uuid, &name, &topic, &description, &avatarKey, &kind, &visibility, &createdAt, &updatedAt, &archivedAt)
 	channel := model.Channel{
-		UUID:      uuid,
-		CreatedAt: createdAt,
+		UUID:        uuid,
+		Topic:       topic.String,
+		Description: description.String,
+		Kind:        kind,
+		Visibility:  visibility,
+		CreatedAt:   createdAt,
 	}
 	if name.Valid && name.String != "" {
 		channel.Name = name.String
 	}
+	if avatarKey.Valid {
+		channel.AvatarKey = &avatarKey.String
+	}
 	if updatedAt.Valid {
 		channel.UpdatedAt = &updatedAt.Time
 	}
+	if archivedAt.Valid {
+		channel.ArchivedAt = &archivedAt.Time
+	}
 	return channel, err
 }
 
 func (s Channels) mapToMember(row interface{ Scan(...any) error }) (model.Member, error) {
 	var (
-		channelUUID string
-		userUUID    string
-		role        model.ChannelRole
-		createdAt   time.Time
-		updatedAt   sql.NullTime
+		channelUUID         string
+		userUUID            string
+		role                model.ChannelRole
+		notify              model.NotifyLevel
+		mutedUntil          sql.NullTime
+		isFavourite         bool
+		sortOrder           sql.NullInt32
+		lastReadMessageUUID sql.NullString
+		lastReadAt          sql.NullTime
+		createdAt           time.Time
+		updatedAt           sql.NullTime
 	)
 
-	err := row.Scan(&channelUUID, &userUUID, &role, &createdAt, &updatedAt)
+	err := row.Scan(&channelUUID, &userUUID, &role, &notify, &mutedUntil, &isFavourite, &sortOrder, &lastReadMessageUUID, &lastReadAt, &createdAt, &updatedAt)
 
 	member := model.Member{
 		ChannelUUID: channelUUID,
 		UserUUID:    userUUID,
 		Role:        role,
+		Notify:      notify,
+		IsFavourite: isFavourite,
 		CreatedAt:   createdAt,
 	}
+	if mutedUntil.Valid {
+		member.MutedUntil = &mutedUntil.Time
+	}
+	if sortOrder.Valid {
+		order := int(sortOrder.Int32)
+		member.SortOrder = &order
+	}
+	if lastReadMessageUUID.Valid {
+		member.LastReadMessageUUID = &lastReadMessageUUID.String
+	}
+	if lastReadAt.Valid {
+		member.LastReadAt = &lastReadAt.Time
+	}
 	if updatedAt.Valid {
 		member.UpdatedAt = &updatedAt.Time
 	}
@@ -35,7 +35,13 @@ type DBStore struct {
 	Sessions      Sessions
 	Channels      Channels
 	Messages      Messages
+	Reactions     Reactions
+	Mentions      Mentions
+	Attachments   Attachments
+	Pins          Pins
+	Invitations   Invitations
 	Verifications Verifications
+	Outbox        Outbox
 }
 
 func NewDBStore(db *sql.DB) DBStore {
@@ -45,6 +51,12 @@ func NewDBStore(db *sql.DB) DBStore {
 		Sessions:      NewSessionStore(db),
 		Channels:      NewChannelStore(db),
 		Messages:      NewMessageStore(db),
+		Reactions:     NewReactionStore(db),
+		Mentions:      NewMentionStore(db),
+		Attachments:   NewAttachmentStore(db),
+		Pins:          NewPinStore(db),
+		Invitations:   NewInvitationStore(db),
 		Verifications: NewVerificationsStore(db),
+		Outbox:        NewOutboxStore(db),
 	}
 }
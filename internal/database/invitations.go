@@ -0,0 +1,126 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"time"
+)
+
+type Invitations struct {
+	db *sql.DB
+
+	create         *sql.Stmt
+	findByCode     *sql.Stmt
+	findForChannel *sql.Stmt
+	use            *sql.Stmt
+	revoke         *sql.Stmt
+}
+
+func NewInvitationStore(db *sql.DB) Invitations {
+	create, err := db.Prepare("INSERT INTO invitations (code, channel_uuid, created_by, created_at, expires_at, max_uses) VALUE (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for invitations.create")
+	}
+	findByCode, err := db.Prepare("SELECT code, channel_uuid, created_by, created_at, expires_at, max_uses, uses, revoked_at FROM invitations WHERE code = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for invitations.findByCode")
+	}
+	findForChannel, err := db.Prepare("SELECT code, channel_uuid, created_by, created_at, expires_at, max_uses, uses, revoked_at FROM invitations WHERE channel_uuid = ? AND revoked_at IS NULL ORDER BY created_at DESC")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for invitations.findForChannel")
+	}
+	// Checks and counts the use in one go, so that concurrent uses can't exceed max_uses
+	use, err := db.Prepare("UPDATE invitations SET uses = uses + 1 WHERE code = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND (max_uses IS NULL OR uses < max_uses)")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for invitations.use")
+	}
+	revoke, err := db.Prepare("UPDATE invitations SET revoked_at = ? WHERE code = ? AND channel_uuid = ? AND revoked_at IS NULL")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for invitations.revoke")
+	}
+
+	return Invitations{
+		db:             db,
+		create:         create,
+		findByCode:     findByCode,
+		findForChannel: findForChannel,
+		use:            use,
+		revoke:         revoke,
+	}
+}
+
+func (s Invitations) Create(i model.Invitation) error {
+	_, err := s.create.Exec(i.Code, i.ChannelUUID, i.CreatedBy.UUID, i.CreatedAt, i.ExpiresAt, i.MaxUses)
+	return err
+}
+
+func (s Invitations) FindByCode(code string) (model.Invitation, error) {
+	invitation, err := s.mapToInvitation(s.findByCode.QueryRow(code))
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return invitation, app.ErrInvitationNotFound
+	}
+	return invitation, err
+}
+
+// FindForChannel returns the invitations to the channel which are not revoked, newest first.
+func (s Invitations) FindForChannel(channelUUID string) ([]model.Invitation, error) {
+	invitations := make([]model.Invitation, 0)
+	rows, err := s.findForChannel.Query(channelUUID)
+	if err != nil {
+		return invitations, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		invitation, err := s.mapToInvitation(rows)
+		if err != nil {
+			return invitations, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, nil
+}
+
+// Use counts a use of the invitation, and tells whether it was still usable at the time.
+func (s Invitations) Use(code string, at time.Time) (bool, error) {
+	result, err := s.use.Exec(code, at)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Revoke stops the invitation from being used, and tells whether there was anything to revoke.
+func (s Invitations) Revoke(channelUUID, code string, at time.Time) (bool, error) {
+	result, err := s.revoke.Exec(at, code, channelUUID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (s Invitations) mapToInvitation(row interface{ Scan(...any) error }) (model.Invitation, error) {
+	var (
+		invitation model.Invitation
+		createdBy  string
+		expiresAt  sql.NullTime
+		maxUses    sql.NullInt32
+		revokedAt  sql.NullTime
+	)
+	err := row.Scan(&invitation.Code, &invitation.ChannelUUID, &createdBy, &invitation.CreatedAt, &expiresAt, &maxUses, &invitation.Uses, &revokedAt)
+	invitation.CreatedBy = model.User{UUID: createdBy}
+	if expiresAt.Valid {
+		invitation.ExpiresAt = &expiresAt.Time
+	}
+	if maxUses.Valid {
+		uses := int(maxUses.Int32)
+		invitation.MaxUses = &uses
+	}
+	if revokedAt.Valid {
+		invitation.RevokedAt = &revokedAt.Time
+	}
+	return invitation, err
+}
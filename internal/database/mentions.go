@@ -0,0 +1,78 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type Mentions struct {
+	db *sql.DB
+
+	create             *sql.Stmt
+	deleteForMessage   *sql.Stmt
+	findForMessagesSQL string
+}
+
+func NewMentionStore(db *sql.DB) Mentions {
+	create, err := db.Prepare("INSERT IGNORE INTO message_mentions (message_uuid, user_uuid, created_at) VALUE (?, ?, ?)")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_mentions.create")
+	}
+	deleteForMessage, err := db.Prepare("DELETE FROM message_mentions WHERE message_uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_mentions.deleteForMessage")
+	}
+	findForMessagesSQL := "SELECT message_uuid, user_uuid FROM message_mentions WHERE message_uuid IN (?)"
+	_, err = db.Prepare(findForMessagesSQL)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_mentions.findForMessages")
+	}
+
+	return Mentions{
+		db:                 db,
+		create:             create,
+		deleteForMessage:   deleteForMessage,
+		findForMessagesSQL: findForMessagesSQL,
+	}
+}
+
+func (s Mentions) Create(messageUUID string, userUUIDs ...string) error {
+	now := time.Now()
+	for _, userUUID := range userUUIDs {
+		if _, err := s.create.Exec(messageUUID, userUUID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s Mentions) DeleteForMessage(messageUUID string) error {
+	_, err := s.deleteForMessage.Exec(messageUUID)
+	return err
+}
+
+// FindForMessages returns the UUIDs of mentioned users by the UUID of the message mentioning them.
+func (s Mentions) FindForMessages(messageUUIDs ...string) (map[string][]string, error) {
+	mentions := map[string][]string{}
+	if len(messageUUIDs) == 0 {
+		return mentions, nil
+	}
+	query, args, err := sqlx.In(s.findForMessagesSQL, messageUUIDs)
+	if err != nil {
+		return mentions, err
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return mentions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var messageUUID, userUUID string
+		if err = rows.Scan(&messageUUID, &userUUID); err != nil {
+			return mentions, err
+		}
+		mentions[messageUUID] = append(mentions[messageUUID], userUUID)
+	}
+	return mentions, nil
+}
@@ -3,8 +3,10 @@ package database
 import (
 	"database/sql"
 	"errors"
+	app "github.com/emilhauk/chitchat/internal"
 	"github.com/emilhauk/chitchat/internal/model"
 	"github.com/jmoiron/sqlx"
+	"slices"
 	"time"
 )
 
@@ -12,61 +14,223 @@ type Messages struct {
 	db *sql.DB
 
 	create                        *sql.Stmt
-	findForChannel                *sql.Stmt
+	findByUUID                    *sql.Stmt
+	findByUUIDsSQL                string
+	findLatestForChannel          *sql.Stmt
+	findForChannelBefore          *sql.Stmt
+	findForChannelAfter           *sql.Stmt
 	findLastMessageForChannelsSQL string
+	findReplies                   *sql.Stmt
+	findMentioning                *sql.Stmt
+	search                        *sql.Stmt
+	countRepliesSQL               string
+	countUnread                   *sql.Stmt
+	update                        *sql.Stmt
+	markDeleted                   *sql.Stmt
+
+	createVersion *sql.Stmt
+	findVersions  *sql.Stmt
+
+	createMention    *sql.Stmt
+	createAttachment *sql.Stmt
 }
 
 func NewMessageStore(db *sql.DB) Messages {
-	create, err := db.Prepare("INSERT INTO messages (uuid, channel_uuid, user_uuid, content, version, sent_at) VALUE (?, ?, ?, ?, ?, ?)")
+	create, err := db.Prepare("INSERT INTO messages (uuid, channel_uuid, user_uuid, parent_uuid, content, version, sent_at) VALUE (?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.create")
 	}
 
-	findForChannel, err := db.Prepare("SELECT uuid, channel_uuid, user_uuid, content, version, sent_at, deleted_at, updated_at FROM messages WHERE channel_uuid = ? ORDER BY sent_at LIMIT ? OFFSET ?")
+	findByUUID, err := db.Prepare("SELECT uuid, channel_uuid, user_uuid, parent_uuid, content, version, sent_at, deleted_at, updated_at FROM messages WHERE uuid = ? AND channel_uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.findByUUID")
+	}
+	findByUUIDsSQL := "SELECT uuid, channel_uuid, user_uuid, parent_uuid, content, version, sent_at, deleted_at, updated_at FROM messages WHERE channel_uuid = ? AND uuid IN (?)"
+	_, err = db.Prepare(findByUUIDsSQL)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.findByUUIDs")
+	}
+
+	// Channel history holds top level messages only. Replies are found through their thread.
+	// Messages are paged by (sent_at, uuid). The uuid breaks ties between messages sent within the same second.
+	findLatestForChannel, err := db.Prepare("SELECT uuid, channel_uuid, user_uuid, parent_uuid, content, version, sent_at, deleted_at, updated_at FROM messages WHERE channel_uuid = ? AND parent_uuid IS NULL ORDER BY sent_at DESC, uuid DESC LIMIT ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.findLatestForChannel")
+	}
+	findForChannelBefore, err := db.Prepare("SELECT uuid, channel_uuid, user_uuid, parent_uuid, content, version, sent_at, deleted_at, updated_at FROM messages WHERE channel_uuid = ? AND parent_uuid IS NULL AND (sent_at < ? OR (sent_at = ? AND uuid < ?)) ORDER BY sent_at DESC, uuid DESC LIMIT ?")
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.findForChannel")
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.findForChannelBefore")
+	}
+	findForChannelAfter, err := db.Prepare("SELECT uuid, channel_uuid, user_uuid, parent_uuid, content, version, sent_at, deleted_at, updated_at FROM messages WHERE channel_uuid = ? AND parent_uuid IS NULL AND (sent_at > ? OR (sent_at = ? AND uuid > ?)) ORDER BY sent_at, uuid LIMIT ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.findForChannelAfter")
 	}
 
 	// findLastMessageForChannelsSQL := "SELECT uuid, channel_uuid, user_uuid, content, version, MAX(sent_at), deleted_at, updated_at FROM messages WHERE channel_uuid IN (?) GROUP BY channel_uuid ORDER BY sent_at DESC"
 	// TODO I expect this not to scale, but lets test it. Clever contributions are very welcome!
-	findLastMessageForChannelsSQL := "SELECT m.* FROM messages m INNER JOIN (SELECT channel_uuid, MAX(sent_at) omg FROM messages GROUP BY channel_uuid) grouped_m ON m.channel_uuid=grouped_m.channel_uuid AND m.sent_at = grouped_m.omg AND m.channel_uuid IN (?)"
+	// Thread replies are not part of the channel history. Messages sent within the same second are told apart by uuid,
+	// like when paging through the history, so that each channel has one last message only.
+	findLastMessageForChannelsSQL := "SELECT m.uuid, m.channel_uuid, m.user_uuid, m.parent_uuid, m.content, m.version, m.sent_at, m.deleted_at, m.updated_at FROM messages m INNER JOIN (SELECT channel_uuid, MAX(sent_at) omg FROM messages WHERE parent_uuid IS NULL GROUP BY channel_uuid) grouped_m ON m.channel_uuid=grouped_m.channel_uuid AND m.sent_at = grouped_m.omg AND m.channel_uuid IN (?) WHERE m.parent_uuid IS NULL AND NOT EXISTS (SELECT 1 FROM messages later WHERE later.channel_uuid = m.channel_uuid AND later.parent_uuid IS NULL AND later.sent_at = m.sent_at AND later.uuid > m.uuid)"
 	_, err = db.Prepare(findLastMessageForChannelsSQL)
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.findLastMessageForChannels")
 	}
 
+	findReplies, err := db.Prepare("SELECT uuid, channel_uuid, user_uuid, parent_uuid, content, version, sent_at, deleted_at, updated_at FROM messages WHERE parent_uuid = ? ORDER BY sent_at, uuid")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.findReplies")
+	}
+	// Only mentions in channels the user is still a member of are of interest
+	findMentioning, err := db.Prepare("SELECT m.uuid, m.channel_uuid, m.user_uuid, m.parent_uuid, m.content, m.version, m.sent_at, m.deleted_at, m.updated_at FROM message_mentions mm INNER JOIN messages m ON m.uuid = mm.message_uuid INNER JOIN channel_members cm ON cm.channel_uuid = m.channel_uuid AND cm.user_uuid = mm.user_uuid WHERE mm.user_uuid = ? AND m.deleted_at IS NULL ORDER BY m.sent_at DESC LIMIT ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.findMentioning")
+	}
+	// Only messages in channels the user is a member of may be found. Filters given as empty strings or NULL are left out.
+	search, err := db.Prepare("SELECT m.uuid, m.channel_uuid, m.user_uuid, m.parent_uuid, m.content, m.version, m.sent_at, m.deleted_at, m.updated_at FROM messages m INNER JOIN channel_members cm ON cm.channel_uuid = m.channel_uuid AND cm.user_uuid = ? WHERE MATCH (m.content) AGAINST (? IN BOOLEAN MODE) AND m.deleted_at IS NULL AND (? = '' OR m.channel_uuid = ?) AND (? = '' OR m.user_uuid = ?) AND (? IS NULL OR m.sent_at >= ?) AND (? IS NULL OR m.sent_at < ?) ORDER BY m.sent_at DESC, m.uuid DESC LIMIT ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.search")
+	}
+	// Unread messages are those in the channel history after the member's read marker, which the member didn't send
+	countUnread, err := db.Prepare("SELECT m.channel_uuid, COUNT(*) FROM messages m INNER JOIN channel_members cm ON cm.channel_uuid = m.channel_uuid WHERE cm.user_uuid = ? AND m.user_uuid <> cm.user_uuid AND m.parent_uuid IS NULL AND m.deleted_at IS NULL AND (cm.last_read_at IS NULL OR m.sent_at > cm.last_read_at OR (m.sent_at = cm.last_read_at AND m.uuid > cm.last_read_message_uuid)) GROUP BY m.channel_uuid")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.countUnread")
+	}
+	countRepliesSQL := "SELECT parent_uuid, COUNT(*) FROM messages WHERE parent_uuid IN (?) AND deleted_at IS NULL GROUP BY parent_uuid"
+	_, err = db.Prepare(countRepliesSQL)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.countReplies")
+	}
+
+	// Only updates the message if it is still at the version we read. Guards against concurrent edits.
+	update, err := db.Prepare("UPDATE messages SET content = ?, version = ?, updated_at = ? WHERE uuid = ? AND version = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.update")
+	}
+
+	markDeleted, err := db.Prepare("UPDATE messages SET deleted_at = ? WHERE uuid = ? AND deleted_at IS NULL")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for messages.markDeleted")
+	}
+
+	createVersion, err := db.Prepare("INSERT INTO message_versions (message_uuid, version, content, created_at) VALUE (?, ?, ?, ?)")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_versions.createVersion")
+	}
+	findVersions, err := db.Prepare("SELECT message_uuid, version, content, created_at FROM message_versions WHERE message_uuid = ? ORDER BY version")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_versions.findVersions")
+	}
+
+	createMention, err := db.Prepare("INSERT IGNORE INTO message_mentions (message_uuid, user_uuid, created_at) VALUE (?, ?, ?)")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_mentions.createMention")
+	}
+	createAttachment, err := db.Prepare("INSERT INTO message_attachments (uuid, message_uuid, channel_uuid, file_name, content_type, size, storage_key, thumbnail_key, created_at) VALUE (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_attachments.createAttachment")
+	}
+
 	return Messages{
 		db:                            db,
 		create:                        create,
-		findForChannel:                findForChannel,
+		findByUUID:                    findByUUID,
+		findByUUIDsSQL:                findByUUIDsSQL,
+		findLatestForChannel:          findLatestForChannel,
+		findForChannelBefore:          findForChannelBefore,
+		findForChannelAfter:           findForChannelAfter,
 		findLastMessageForChannelsSQL: findLastMessageForChannelsSQL,
+		findReplies:                   findReplies,
+		findMentioning:                findMentioning,
+		search:                        search,
+		countRepliesSQL:               countRepliesSQL,
+		countUnread:                   countUnread,
+		update:                        update,
+		markDeleted:                   markDeleted,
+		createVersion:                 createVersion,
+		findVersions:                  findVersions,
+		createMention:                 createMention,
+		createAttachment:              createAttachment,
 	}
 }
 
+// Create stores the message along with its mentions and attachments. Either all of it is stored, or none of it.
 func (s Messages) Create(channelUUID string, m model.Message) error {
-	_, err := s.create.Exec(m.UUID, channelUUID, m.Sender.UUID, m.Content, m.Version, m.SentAt)
-	return err
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Stmt(s.create).Exec(m.UUID, channelUUID, m.Sender.UUID, m.ParentUUID, m.Content, m.Version, m.SentAt)
+	for _, user := range m.Mentions {
+		if err != nil {
+			break
+		}
+		_, err = tx.Stmt(s.createMention).Exec(m.UUID, user.UUID, m.SentAt)
+	}
+	for _, a := range m.Attachments {
+		if err != nil {
+			break
+		}
+		_, err = tx.Stmt(s.createAttachment).Exec(a.UUID, a.MessageUUID, a.ChannelUUID, a.FileName, a.ContentType, a.Size, a.StorageKey, a.ThumbnailKey, a.CreatedAt)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
-func (s Messages) FindForChannel(channelUUID string, limit, offset int32) ([]model.Message, error) {
-	messages := make([]model.Message, 0)
-	rows, err := s.findForChannel.Query(channelUUID, limit, offset)
+func (s Messages) FindByUUID(channelUUID, messageUUID string) (model.Message, error) {
+	message, err := s.mapToMessage(s.findByUUID.QueryRow(messageUUID, channelUUID))
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return message, app.ErrMessageNotFound
+	}
+	return message, err
+}
+
+// FindByUUIDs returns the messages of the channel which are found, by UUID.
+func (s Messages) FindByUUIDs(channelUUID string, messageUUIDs ...string) (map[string]model.Message, error) {
+	messages := map[string]model.Message{}
+	if len(messageUUIDs) == 0 {
+		return messages, nil
+	}
+	query, args, err := sqlx.In(s.findByUUIDsSQL, channelUUID, messageUUIDs)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return messages, nil
-		}
 		return messages, err
 	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return messages, err
+	}
+	defer rows.Close()
 	for rows.Next() {
-		channel, err := s.mapToMessage(rows)
+		message, err := s.mapToMessage(rows)
 		if err != nil {
 			return messages, err
 		}
-		messages = append(messages, channel)
+		messages[message.UUID] = message
 	}
 	return messages, nil
 }
 
+// FindLatestForChannel returns the newest messages of the channel, oldest first.
+func (s Messages) FindLatestForChannel(channelUUID string, limit int32) ([]model.Message, error) {
+	messages, err := s.queryMessages(s.findLatestForChannel, channelUUID, limit)
+	slices.Reverse(messages)
+	return messages, err
+}
+
+// FindForChannelBefore returns the messages sent right before cursor, oldest first.
+func (s Messages) FindForChannelBefore(channelUUID string, cursor model.Message, limit int32) ([]model.Message, error) {
+	messages, err := s.queryMessages(s.findForChannelBefore, channelUUID, cursor.SentAt, cursor.SentAt, cursor.UUID, limit)
+	slices.Reverse(messages)
+	return messages, err
+}
+
+// FindForChannelAfter returns the messages sent right after cursor, oldest first.
+func (s Messages) FindForChannelAfter(channelUUID string, cursor model.Message, limit int32) ([]model.Message, error) {
+	return s.queryMessages(s.findForChannelAfter, channelUUID, cursor.SentAt, cursor.SentAt, cursor.UUID, limit)
+}
+
 func (s Messages) FindLastMessageForChannels(channelUUIDs ...string) ([]model.Message, error) {
 	messages := make([]model.Message, 0)
 	query, args, err := sqlx.In(s.findLastMessageForChannelsSQL, channelUUIDs)
@@ -89,11 +253,151 @@ func (s Messages) FindLastMessageForChannels(channelUUIDs ...string) ([]model.Me
 	return messages, nil
 }
 
+// FindReplies returns all replies in the thread started by the message with parentUUID, oldest first.
+func (s Messages) FindReplies(parentUUID string) ([]model.Message, error) {
+	return s.queryMessages(s.findReplies, parentUUID)
+}
+
+// FindMentioning returns the latest messages mentioning the user, newest first.
+func (s Messages) FindMentioning(userUUID string, limit int32) ([]model.Message, error) {
+	return s.queryMessages(s.findMentioning, userUUID, limit)
+}
+
+// Search returns the newest messages matching the query in channels the user is a member of.
+func (s Messages) Search(userUUID string, query model.SearchQuery, limit int32) ([]model.Message, error) {
+	return s.queryMessages(s.search, userUUID, query.BooleanExpression(),
+		query.ChannelUUID, query.ChannelUUID,
+		query.SenderUUID, query.SenderUUID,
+		query.From, query.From,
+		query.Until(), query.Until(),
+		limit)
+}
+
+// CountReplies returns the number of replies which are not deleted, by the UUID of the message they reply to.
+func (s Messages) CountReplies(parentUUIDs ...string) (map[string]int, error) {
+	counts := map[string]int{}
+	if len(parentUUIDs) == 0 {
+		return counts, nil
+	}
+	query, args, err := sqlx.In(s.countRepliesSQL, parentUUIDs)
+	if err != nil {
+		return counts, err
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			parentUUID string
+			count      int
+		)
+		if err = rows.Scan(&parentUUID, &count); err != nil {
+			return counts, err
+		}
+		counts[parentUUID] = count
+	}
+	return counts, nil
+}
+
+// CountUnread returns the number of unread messages by channel UUID, for every channel the user is a member of.
+// Channels without unread messages are left out.
+func (s Messages) CountUnread(userUUID string) (map[string]int, error) {
+	counts := map[string]int{}
+	rows, err := s.countUnread.Query(userUUID)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			channelUUID string
+			count       int
+		)
+		if err = rows.Scan(&channelUUID, &count); err != nil {
+			return counts, err
+		}
+		counts[channelUUID] = count
+	}
+	return counts, nil
+}
+
+// Update stores the new content of m and archives the replaced content as previous. Both happen in the same
+// transaction, so history is never lost for an edit that went through.
+func (s Messages) Update(m model.Message, previous model.MessageVersion) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Stmt(s.createVersion).Exec(previous.MessageUUID, previous.Version, previous.Content, previous.CreatedAt)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	result, err := tx.Stmt(s.update).Exec(m.Content, m.Version, m.UpdatedAt, m.UUID, previous.Version)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		_ = tx.Rollback()
+		if err != nil {
+			return err
+		}
+		return app.ErrMessageEditConflict
+	}
+	return tx.Commit()
+}
+
+func (s Messages) MarkDeleted(uuid string, deletedAt time.Time) error {
+	_, err := s.markDeleted.Exec(deletedAt, uuid)
+	return err
+}
+
+func (s Messages) FindVersions(messageUUID string) ([]model.MessageVersion, error) {
+	versions := make([]model.MessageVersion, 0)
+	rows, err := s.findVersions.Query(messageUUID)
+	if err != nil {
+		return versions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		version, err := s.mapToMessageVersion(rows)
+		if err != nil {
+			return versions, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+func (s Messages) queryMessages(stmt *sql.Stmt, args ...any) ([]model.Message, error) {
+	messages := make([]model.Message, 0)
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return messages, nil
+		}
+		return messages, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		message, err := s.mapToMessage(rows)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
 func (s Messages) mapToMessage(row interface{ Scan(...any) error }) (model.Message, error) {
 	var (
 		uuid        string
 		channelUUID string
 		userUUID    string
+		parentUUID  sql.NullString
 		content     string
 		version     uint32
 		sentAt      time.Time
@@ -101,14 +405,18 @@ func (s Messages) mapToMessage(row interface{ Scan(...any) error }) (model.Messa
 		updatedAt   sql.NullTime
 	)
 
-	err := row.Scan(&uuid, &channelUUID, &userUUID, &content, &version, &sentAt, &deletedAt, &updatedAt)
+	err := row.Scan(&uuid, &channelUUID, &userUUID, &parentUUID, &content, &version, &sentAt, &deletedAt, &updatedAt)
 	message := model.Message{
 		UUID:        uuid,
 		ChannelUUID: channelUUID,
 		Sender:      model.User{UUID: userUUID},
 		Content:     content,
+		Version:     version,
 		SentAt:      sentAt,
 	}
+	if parentUUID.Valid && parentUUID.String != "" {
+		message.ParentUUID = &parentUUID.String
+	}
 	if deletedAt.Valid {
 		message.DeletedAt = &deletedAt.Time
 	}
@@ -118,3 +426,20 @@ func (s Messages) mapToMessage(row interface{ Scan(...any) error }) (model.Messa
 
 	return message, err
 }
+
+func (s Messages) mapToMessageVersion(row interface{ Scan(...any) error }) (model.MessageVersion, error) {
+	var (
+		messageUUID string
+		version     uint32
+		content     string
+		createdAt   time.Time
+	)
+
+	err := row.Scan(&messageUUID, &version, &content, &createdAt)
+	return model.MessageVersion{
+		MessageUUID: messageUUID,
+		Version:     version,
+		Content:     content,
+		CreatedAt:   createdAt,
+	}, err
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/emilhauk/chitchat/internal/model"
+	"time"
+)
+
+type Outbox struct {
+	db *sql.DB
+
+	create           *sql.Stmt
+	findDue          *sql.Stmt
+	markSent         *sql.Stmt
+	markFailed       *sql.Stmt
+	deleteSentBefore *sql.Stmt
+}
+
+func NewOutboxStore(db *sql.DB) Outbox {
+	create, err := db.Prepare("INSERT INTO mail_outbox (uuid, recipient, subject, text_body, html_body, created_at, next_attempt_at) VALUE (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for mail_outbox.create")
+	}
+	findDue, err := db.Prepare("SELECT uuid, recipient, subject, text_body, html_body, created_at, attempts, last_error, next_attempt_at, sent_at FROM mail_outbox WHERE sent_at IS NULL AND next_attempt_at <= ? AND attempts < ? ORDER BY next_attempt_at LIMIT ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for mail_outbox.findDue")
+	}
+	markSent, err := db.Prepare("UPDATE mail_outbox SET sent_at = ? WHERE uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for mail_outbox.markSent")
+	}
+	markFailed, err := db.Prepare("UPDATE mail_outbox SET attempts = ?, last_error = ?, next_attempt_at = ? WHERE uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for mail_outbox.markFailed")
+	}
+	deleteSentBefore, err := db.Prepare("DELETE FROM mail_outbox WHERE sent_at < ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for mail_outbox.deleteSentBefore")
+	}
+
+	return Outbox{
+		db:               db,
+		create:           create,
+		findDue:          findDue,
+		markSent:         markSent,
+		markFailed:       markFailed,
+		deleteSentBefore: deleteSentBefore,
+	}
+}
+
+func (s Outbox) Create(m model.Mail) error {
+	_, err := s.create.Exec(m.UUID, m.Recipient, m.Subject, m.Text, m.HTML, m.CreatedAt, m.NextAttemptAt)
+	return err
+}
+
+// FindDue returns up to limit unsent mails which are due to be sent at now, and have not yet failed maxAttempts times.
+func (s Outbox) FindDue(now time.Time, maxAttempts, limit int) ([]model.Mail, error) {
+	mails := make([]model.Mail, 0)
+	rows, err := s.findDue.Query(now, maxAttempts, limit)
+	if err != nil {
+		return mails, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		mail, err := s.mapToMail(rows)
+		if err != nil {
+			return mails, err
+		}
+		mails = append(mails, mail)
+	}
+	return mails, rows.Err()
+}
+
+func (s Outbox) MarkSent(m model.Mail) error {
+	_, err := s.markSent.Exec(m.SentAt, m.UUID)
+	return err
+}
+
+// MarkFailed records the mail's failed attempts, and when to try sending it again.
+func (s Outbox) MarkFailed(m model.Mail) error {
+	_, err := s.markFailed.Exec(m.Attempts, m.LastError, m.NextAttemptAt, m.UUID)
+	return err
+}
+
+func (s Outbox) DeleteSentBefore(threshold time.Time) error {
+	_, err := s.deleteSentBefore.Exec(threshold)
+	return err
+}
+
+func (s Outbox) mapToMail(row interface{ Scan(...any) error }) (model.Mail, error) {
+	var (
+		mail      model.Mail
+		lastError sql.NullString
+		sentAt    sql.NullTime
+	)
+	err := row.Scan(&mail.UUID, &mail.Recipient, &mail.Subject, &mail.Text, &mail.HTML, &mail.CreatedAt, &mail.Attempts, &lastError, &mail.NextAttemptAt, &sentAt)
+	mail.LastError = lastError.String
+	if sentAt.Valid {
+		mail.SentAt = &sentAt.Time
+	}
+	return mail, err
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/emilhauk/chitchat/internal/model"
+	"time"
+)
+
+type Pins struct {
+	db *sql.DB
+
+	create         *sql.Stmt
+	remove         *sql.Stmt
+	findForChannel *sql.Stmt
+}
+
+func NewPinStore(db *sql.DB) Pins {
+	create, err := db.Prepare("INSERT IGNORE INTO channel_pins (channel_uuid, message_uuid, pinned_by, pinned_at) VALUE (?, ?, ?, ?)")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_pins.create")
+	}
+	remove, err := db.Prepare("DELETE FROM channel_pins WHERE channel_uuid = ? AND message_uuid = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_pins.remove")
+	}
+	findForChannel, err := db.Prepare("SELECT channel_uuid, message_uuid, pinned_by, pinned_at FROM channel_pins WHERE channel_uuid = ? ORDER BY pinned_at DESC")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for channel_pins.findForChannel")
+	}
+
+	return Pins{
+		db:             db,
+		create:         create,
+		remove:         remove,
+		findForChannel: findForChannel,
+	}
+}
+
+func (s Pins) Create(pin model.Pin) error {
+	_, err := s.create.Exec(pin.ChannelUUID, pin.MessageUUID, pin.PinnedBy.UUID, pin.PinnedAt)
+	return err
+}
+
+// Delete removes the pin, and tells whether there was anything to remove.
+func (s Pins) Delete(channelUUID, messageUUID string) (bool, error) {
+	result, err := s.remove.Exec(channelUUID, messageUUID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// FindForChannel returns the pins of the channel, latest pinned first.
+func (s Pins) FindForChannel(channelUUID string) ([]model.Pin, error) {
+	pins := make([]model.Pin, 0)
+	rows, err := s.findForChannel.Query(channelUUID)
+	if err != nil {
+		return pins, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			pin      model.Pin
+			pinnedBy string
+			pinnedAt time.Time
+		)
+		err = rows.Scan(&pin.ChannelUUID, &pin.MessageUUID, &pinnedBy, &pinnedAt)
+		if err != nil {
+			return pins, err
+		}
+		pin.PinnedBy = model.User{UUID: pinnedBy}
+		pin.PinnedAt = pinnedAt
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type Reactions struct {
+	db *sql.DB
+
+	create             *sql.Stmt
+	remove             *sql.Stmt
+	findForMessagesSQL string
+}
+
+func NewReactionStore(db *sql.DB) Reactions {
+	create, err := db.Prepare("INSERT IGNORE INTO message_reactions (message_uuid, user_uuid, emoji, created_at) VALUE (?, ?, ?, ?)")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_reactions.create")
+	}
+	remove, err := db.Prepare("DELETE FROM message_reactions WHERE message_uuid = ? AND user_uuid = ? AND emoji = ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_reactions.remove")
+	}
+	findForMessagesSQL := "SELECT message_uuid, user_uuid, emoji, created_at FROM message_reactions WHERE message_uuid IN (?) ORDER BY created_at"
+	_, err = db.Prepare(findForMessagesSQL)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for message_reactions.findForMessages")
+	}
+
+	return Reactions{
+		db:                 db,
+		create:             create,
+		remove:             remove,
+		findForMessagesSQL: findForMessagesSQL,
+	}
+}
+
+func (s Reactions) Create(m model.Reaction) error {
+	_, err := s.create.Exec(m.MessageUUID, m.UserUUID, m.Emoji, m.CreatedAt)
+	return err
+}
+
+// Delete removes the reaction, and tells whether there was anything to remove.
+func (s Reactions) Delete(m model.Reaction) (bool, error) {
+	result, err := s.remove.Exec(m.MessageUUID, m.UserUUID, m.Emoji)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (s Reactions) FindForMessages(messageUUIDs ...string) ([]model.Reaction, error) {
+	reactions := make([]model.Reaction, 0)
+	if len(messageUUIDs) == 0 {
+		return reactions, nil
+	}
+	query, args, err := sqlx.In(s.findForMessagesSQL, messageUUIDs)
+	if err != nil {
+		return reactions, err
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return reactions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		reaction, err := s.mapToReaction(rows)
+		if err != nil {
+			return reactions, err
+		}
+		reactions = append(reactions, reaction)
+	}
+	return reactions, nil
+}
+
+func (s Reactions) mapToReaction(row interface{ Scan(...any) error }) (model.Reaction, error) {
+	var (
+		messageUUID string
+		userUUID    string
+		emoji       string
+		createdAt   time.Time
+	)
+	err := row.Scan(&messageUUID, &userUUID, &emoji, &createdAt)
+	return model.Reaction{
+		MessageUUID: messageUUID,
+		UserUUID:    userUUID,
+		Emoji:       emoji,
+		CreatedAt:   createdAt,
+	}, err
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	app "github.com/emilhauk/chitchat/internal"
 	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -15,6 +16,8 @@ type Sessions struct {
 	findById         *sql.Stmt
 	updateLastSeenAt *sql.Stmt
 	delete           *sql.Stmt
+
+	findLastSeenForUsersSQL string
 }
 
 func NewSessionStore(db *sql.DB) Sessions {
@@ -34,12 +37,18 @@ func NewSessionStore(db *sql.DB) Sessions {
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for sessions.remove")
 	}
+	findLastSeenForUsersSQL := "SELECT user_uuid, MAX(last_seen_at) FROM sessions WHERE user_uuid IN (?) AND last_seen_at IS NOT NULL GROUP BY user_uuid"
+	_, err = db.Prepare(findLastSeenForUsersSQL)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for sessions.findLastSeenForUsers")
+	}
 	return Sessions{
-		db:               db,
-		create:           create,
-		findById:         findById,
-		updateLastSeenAt: updateLastSeenAt,
-		delete:           remove,
+		db:                      db,
+		create:                  create,
+		findById:                findById,
+		updateLastSeenAt:        updateLastSeenAt,
+		delete:                  remove,
+		findLastSeenForUsersSQL: findLastSeenForUsersSQL,
 	}
 }
 
@@ -61,6 +70,35 @@ func (s Sessions) SetLastSeenAt(id string, lastSeenAt time.Time) error {
 	return err
 }
 
+// FindLastSeenForUsers returns when each user was last seen in any of their sessions, by user UUID. Users never seen
+// are left out.
+func (s Sessions) FindLastSeenForUsers(userUUIDs ...string) (map[string]time.Time, error) {
+	lastSeen := map[string]time.Time{}
+	if len(userUUIDs) == 0 {
+		return lastSeen, nil
+	}
+	query, args, err := sqlx.In(s.findLastSeenForUsersSQL, userUUIDs)
+	if err != nil {
+		return lastSeen, err
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return lastSeen, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			userUUID   string
+			lastSeenAt time.Time
+		)
+		if err = rows.Scan(&userUUID, &lastSeenAt); err != nil {
+			return lastSeen, err
+		}
+		lastSeen[userUUID] = lastSeenAt
+	}
+	return lastSeen, nil
+}
+
 func (s Sessions) Delete(id string) error {
 	_, err := s.delete.Exec(id)
 	return err
@@ -12,6 +12,7 @@ type Verifications struct {
 	create           *sql.Stmt
 	findByUUID       *sql.Stmt
 	findAllOlderThan *sql.Stmt
+	attempt          *sql.Stmt
 	deleteByUUID     *sql.Stmt
 }
 
@@ -20,14 +21,18 @@ func NewVerificationsStore(db *sql.DB) Verifications {
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for field_verifications.create")
 	}
-	findByUUID, err := db.Prepare("SELECT uuid, code, user_uuid, field_name, field_value, created_at FROM field_verifications WHERE uuid = ?")
+	findByUUID, err := db.Prepare("SELECT uuid, code, user_uuid, field_name, field_value, attempts, created_at FROM field_verifications WHERE uuid = ?")
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for field_verifications.findByCode")
 	}
-	findAllOlderThan, err := db.Prepare("SELECT uuid, code, user_uuid, field_name, field_value, created_at FROM field_verifications WHERE created_at < ?")
+	findAllOlderThan, err := db.Prepare("SELECT uuid, code, user_uuid, field_name, field_value, attempts, created_at FROM field_verifications WHERE created_at < ?")
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for field_verifications.findAllOlderThan")
 	}
+	attempt, err := db.Prepare("UPDATE field_verifications SET attempts = attempts + 1 WHERE uuid = ? AND attempts < ? AND created_at > ?")
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to prepare statement for field_verifications.attempt")
+	}
 	deleteByUUID, err := db.Prepare("DELETE FROM field_verifications WHERE uuid = ?")
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to prepare statement for field_verifications.deleteByUUID")
@@ -37,6 +42,7 @@ func NewVerificationsStore(db *sql.DB) Verifications {
 		create:           create,
 		findByUUID:       findByUUID,
 		findAllOlderThan: findAllOlderThan,
+		attempt:          attempt,
 		deleteByUUID:     deleteByUUID,
 	}
 }
@@ -66,6 +72,17 @@ func (s Verifications) FindAllOlderThan(threshold time.Time) (verifications []mo
 	return verifications, nil
 }
 
+// Attempt counts an attempt at the verification's code, and tells whether the verification was created after notBefore
+// and had fewer than maxAttempts attempts before this one.
+func (s Verifications) Attempt(uuid string, maxAttempts int, notBefore time.Time) (bool, error) {
+	result, err := s.attempt.Exec(uuid, maxAttempts, notBefore)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
 func (s Verifications) DeleteByUUID(uuid string) error {
 	_, err := s.deleteByUUID.Exec(uuid)
 	return err
@@ -78,14 +95,16 @@ func (s Verifications) mapToFieldVerification(row interface{ Scan(...any) error
 		userUUID   sql.NullString
 		fieldName  string
 		fieldValue string
+		attempts   int
 		createdAt  time.Time
 	)
-	err := row.Scan(&uuid, &code, &userUUID, &fieldName, &fieldValue, &createdAt)
+	err := row.Scan(&uuid, &code, &userUUID, &fieldName, &fieldValue, &attempts, &createdAt)
 	verification := model.FieldVerification{
 		UUID:       uuid,
 		Code:       code,
 		FieldName:  fieldName,
 		FieldValue: fieldValue,
+		Attempts:   attempts,
 		CreatedAt:  createdAt,
 	}
 	if userUUID.Valid && userUUID.String != "" {
@@ -12,6 +12,26 @@ var (
 	ErrMemberNotFound               = errors.New("member not found")
 	ErrFieldVerificationNotFound    = errors.New("field verification not found")
 	ErrFieldVerificationCodeInvalid = errors.New("field verification code invalid")
+	ErrFieldVerificationExpired     = errors.New("field verification is expired or used up")
 	ErrUnsupportedValidationField   = errors.New("unsupported verification field")
 	ErrUserHasNoPassword            = errors.New("user has no password")
+	ErrMessageNotFound              = errors.New("message not found")
+	ErrMessageDeleted               = errors.New("message is deleted")
+	ErrMessageEditConflict          = errors.New("message was changed by someone else")
+	ErrUnsupportedReaction          = errors.New("unsupported reaction")
+	ErrPermissionDenied             = errors.New("permission denied")
+	ErrAttachmentNotFound           = errors.New("attachment not found")
+	ErrAttachmentTooLarge           = errors.New("attachment is too large")
+	ErrBlobNotFound                 = errors.New("blob not found")
+	ErrSearchTooShort               = errors.New("nothing to search for")
+	ErrInvitationNotFound           = errors.New("invitation not found")
+	ErrInvitationNotUsable          = errors.New("invitation is expired, used up or revoked")
+	ErrLastOwner                    = errors.New("channel must keep an owner")
+	ErrUnsupportedRole              = errors.New("unsupported role")
+	ErrUnsupportedNotifyLevel       = errors.New("unsupported notification level")
+	ErrChannelArchived              = errors.New("channel is archived")
+	ErrChannelSettingsInvalid       = errors.New("channel settings are invalid")
+	ErrAvatarNotFound               = errors.New("avatar not found")
+	ErrUnsupportedImage             = errors.New("unsupported image")
+	ErrQRCodeContentTooLong         = errors.New("content is too long for a QR code")
 )
@@ -0,0 +1,49 @@
+// Package mailer writes the emails chitchat sends, and sends them over SMTP.
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"github.com/emilhauk/chitchat/config"
+	"github.com/emilhauk/chitchat/internal/model"
+	htmlTemplate "html/template"
+	"strings"
+	textTemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Every mail has a text and an HTML template by the same name. The text templates also define the mail's subject, as
+// "<name>-subject".
+var (
+	htmlTemplates = htmlTemplate.Must(htmlTemplate.ParseFS(templateFS, "templates/*.html"))
+	textTemplates = textTemplate.Must(textTemplate.ParseFS(templateFS, "templates/*.txt"))
+)
+
+// VerificationCode is the mail asking the recipient to confirm their email address by entering code.
+func VerificationCode(recipient, code string) (model.Mail, error) {
+	return compose(recipient, "verification-code", map[string]any{
+		"Code":      code,
+		"Email":     recipient,
+		"PublicURL": config.App.PublicURL,
+	})
+}
+
+func compose(recipient, name string, data any) (model.Mail, error) {
+	mail := model.Mail{Recipient: recipient}
+	var subject, text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&subject, name+"-subject", data); err != nil {
+		return mail, err
+	}
+	if err := textTemplates.ExecuteTemplate(&text, name, data); err != nil {
+		return mail, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name, data); err != nil {
+		return mail, err
+	}
+	mail.Subject = strings.TrimSpace(subject.String())
+	mail.Text = strings.TrimSpace(text.String()) + "\n"
+	mail.HTML = strings.TrimSpace(html.String()) + "\n"
+	return mail, nil
+}
@@ -0,0 +1,237 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/emilhauk/chitchat/config"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/google/uuid"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+
+	AuthPlain = "plain"
+	AuthLogin = "login"
+)
+
+// sendTimeout limits how long sending a single mail may take, from connecting to quitting.
+const sendTimeout = time.Minute
+
+// SMTP sends mails through the SMTP server given by config.SMTPConfig.
+type SMTP struct {
+	config    config.SMTPConfig
+	from      *mail.Address
+	tlsConfig *tls.Config
+}
+
+func NewSMTPSender(smtpConfig config.SMTPConfig) (SMTP, error) {
+	sender := SMTP{
+		config:    smtpConfig,
+		tlsConfig: &tls.Config{ServerName: smtpConfig.Host},
+	}
+	if smtpConfig.Host == "" {
+		return sender, errors.New("no SMTP host given")
+	}
+	switch smtpConfig.TLS {
+	case TLSNone, TLSStartTLS, TLSImplicit:
+	default:
+		return sender, fmt.Errorf("unknown SMTP TLS mode %q. Use either %s, %s or %s", smtpConfig.TLS, TLSNone, TLSStartTLS, TLSImplicit)
+	}
+	switch smtpConfig.Auth {
+	case AuthPlain, AuthLogin:
+	default:
+		return sender, fmt.Errorf("unknown SMTP auth mechanism %q. Use either %s or %s", smtpConfig.Auth, AuthPlain, AuthLogin)
+	}
+	from, err := mail.ParseAddress(smtpConfig.From)
+	if err != nil {
+		return sender, fmt.Errorf("invalid from address %q: %w", smtpConfig.From, err)
+	}
+	sender.from = from
+	return sender, nil
+}
+
+// WithTLSConfig returns a sender using tlsConfig for its encrypted connections, like one trusting a self-signed
+// certificate.
+func (s SMTP) WithTLSConfig(tlsConfig *tls.Config) SMTP {
+	s.tlsConfig = tlsConfig
+	return s
+}
+
+// Send delivers the mail to the SMTP server, which takes it from there.
+func (s SMTP) Send(m model.Mail) error {
+	recipient, err := mail.ParseAddress(m.Recipient)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", m.Recipient, err)
+	}
+	message, err := s.buildMessage(recipient, m)
+	if err != nil {
+		return fmt.Errorf("failed to build message: %w", err)
+	}
+
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.config.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err = client.StartTLS(s.tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if s.config.Username != "" {
+		if err = client.Auth(s.auth()); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	if err = client.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err = client.Rcpt(recipient.Address); err != nil {
+		return err
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = data.Write(message); err != nil {
+		return err
+	}
+	if err = data.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (s SMTP) connect() (*smtp.Client, error) {
+	address := net.JoinHostPort(s.config.Host, s.config.Port)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.config.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	if err = conn.SetDeadline(time.Now().Add(sendTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to greet %s: %w", address, err)
+	}
+	return client, nil
+}
+
+func (s SMTP) auth() smtp.Auth {
+	if s.config.Auth == AuthLogin {
+		return loginAuth{username: s.config.Username, password: s.config.Password, host: s.config.Host}
+	}
+	return smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+}
+
+// buildMessage writes the mail as a multipart/alternative message, with the text body first and the HTML body last, as
+// the last one is preferred by mail clients able to show it.
+func (s SMTP) buildMessage(recipient *mail.Address, m model.Mail) ([]byte, error) {
+	var message bytes.Buffer
+	body := multipart.NewWriter(&message)
+
+	header := []string{
+		"From: " + s.from.String(),
+		"To: " + recipient.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		fmt.Sprintf("Message-ID: <%s@%s>", uuid.NewString(), s.fromDomain()),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q", body.Boundary()),
+	}
+	message.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		writer, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err = encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err = encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+func (s SMTP) fromDomain() string {
+	_, domain, _ := strings.Cut(s.from.Address, "@")
+	return domain
+}
+
+// loginAuth is the LOGIN mechanism, which net/smtp lacks. Like smtp.PlainAuth, it refuses to send the credentials over
+// an unencrypted connection, unless to localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
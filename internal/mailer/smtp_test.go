@@ -0,0 +1,137 @@
+package mailer_test
+
+import (
+	"github.com/emilhauk/chitchat/config"
+	"github.com/emilhauk/chitchat/internal/mailer"
+	"github.com/emilhauk/chitchat/internal/mailer/smtptest"
+	"github.com/emilhauk/chitchat/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestSMTPSend(t *testing.T) {
+	tests := []struct {
+		name        string
+		implicitTLS bool
+		auth        string
+	}{
+		{name: "STARTTLS with PLAIN", auth: mailer.AuthPlain},
+		{name: "STARTTLS with LOGIN", auth: mailer.AuthLogin},
+		{name: "implicit TLS with PLAIN", implicitTLS: true, auth: mailer.AuthPlain},
+		{name: "implicit TLS with LOGIN", implicitTLS: true, auth: mailer.AuthLogin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newServer(tt.implicitTLS)
+			defer server.Close()
+			server.RequireAuth("chitchat", "password")
+			smtpConfig := server.Config()
+			smtpConfig.Auth = tt.auth
+			smtpConfig.From = "Chitchat <chitchat@example.com>"
+			sender, err := mailer.NewSMTPSender(smtpConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mail, err := mailer.VerificationCode("someone@example.com", "123456")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = sender.WithTLSConfig(server.ClientTLSConfig()).Send(mail); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			messages := server.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("server received %d messages, want 1", len(messages))
+			}
+			message := messages[0]
+			if message.Username != "chitchat" {
+				t.Errorf("sent as %q, want chitchat", message.Username)
+			}
+			if message.From != "chitchat@example.com" || len(message.To) != 1 || message.To[0] != "someone@example.com" {
+				t.Errorf("sent from %q to %q", message.From, message.To)
+			}
+			for _, want := range []string{
+				`From: "Chitchat" <chitchat@example.com>`,
+				"To: <someone@example.com>",
+				"Subject: 123456 is your chitchat verification code",
+				"Content-Type: multipart/alternative",
+				"Content-Type: text/plain; charset=utf-8",
+				"Content-Type: text/html; charset=utf-8",
+			} {
+				if !message.Contains(want) {
+					t.Errorf("message lacks %q:\n%s", want, message.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestSMTPSendRefused(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+	server.RequireAuth("chitchat", "password")
+
+	wrongPassword := server.Config()
+	wrongPassword.Password = "wrong"
+	unauthenticated := server.Config()
+	unauthenticated.Username = ""
+
+	tests := []struct {
+		name       string
+		smtpConfig config.SMTPConfig
+		trusted    bool
+		wantErr    string
+	}{
+		{name: "wrong password", smtpConfig: wrongPassword, trusted: true, wantErr: "535"},
+		{name: "unauthenticated", smtpConfig: unauthenticated, trusted: true, wantErr: "530"},
+		{name: "untrusted certificate", smtpConfig: server.Config(), wantErr: "failed to start TLS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender, err := mailer.NewSMTPSender(tt.smtpConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.trusted {
+				sender = sender.WithTLSConfig(server.ClientTLSConfig())
+			}
+			err = sender.Send(model.Mail{Recipient: "someone@example.com", Subject: "Hi", Text: "Hi", HTML: "<p>Hi</p>"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Send returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+	if messages := server.Messages(); len(messages) != 0 {
+		t.Errorf("server received %d messages, want none", len(messages))
+	}
+}
+
+func TestNewSMTPSenderInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(smtpConfig *config.SMTPConfig)
+	}{
+		{name: "no host", modify: func(c *config.SMTPConfig) { c.Host = "" }},
+		{name: "unknown TLS mode", modify: func(c *config.SMTPConfig) { c.TLS = "ssl" }},
+		{name: "unknown auth mechanism", modify: func(c *config.SMTPConfig) { c.Auth = "cram-md5" }},
+		{name: "invalid from address", modify: func(c *config.SMTPConfig) { c.From = "chitchat" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smtpConfig := config.SMTPConfig{Host: "localhost", Port: "587", Auth: mailer.AuthPlain, TLS: mailer.TLSStartTLS, From: "chitchat@example.com"}
+			tt.modify(&smtpConfig)
+			if _, err := mailer.NewSMTPSender(smtpConfig); err == nil {
+				t.Errorf("NewSMTPSender accepted %+v", smtpConfig)
+			}
+		})
+	}
+}
+
+func newServer(implicitTLS bool) *smtptest.Server {
+	if implicitTLS {
+		return smtptest.NewTLSServer()
+	}
+	return smtptest.NewServer()
+}
@@ -0,0 +1,418 @@
+// Package smtptest provides an SMTP server for tests, which keeps the mails sent to it instead of delivering them. It is
+// to the mailer what net/http/httptest is to HTTP clients.
+package smtptest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"github.com/emilhauk/chitchat/config"
+	"github.com/emilhauk/chitchat/internal/mailer"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a mail as received by the server.
+type Message struct {
+	From string
+	To   []string
+	// Username is who authenticated before sending the message, if anyone
+	Username string
+	// Data is the message, headers and all, as sent by the client
+	Data []byte
+}
+
+// Contains tells whether the message, as sent, contains content.
+func (m Message) Contains(content string) bool {
+	return bytes.Contains(m.Data, []byte(content))
+}
+
+// Server listens on localhost until closed. It offers STARTTLS, unless started with NewTLSServer, where the connection
+// is encrypted from the start. Both use a self-signed certificate trusted by ClientTLSConfig.
+type Server struct {
+	// Host and Port is where the server listens
+	Host string
+	Port string
+
+	listener    net.Listener
+	implicitTLS bool
+	tlsConfig   *tls.Config
+	certificate *x509.Certificate
+
+	mu        sync.Mutex
+	username  string
+	password  string
+	failNext  int
+	messages  []Message
+	received  chan struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	waitGroup sync.WaitGroup
+}
+
+// NewServer starts a server offering STARTTLS.
+func NewServer() *Server {
+	return start(false)
+}
+
+// NewTLSServer starts a server with implicit TLS.
+func NewTLSServer() *Server {
+	return start(true)
+}
+
+func start(implicitTLS bool) *Server {
+	certificate, tlsCertificate := newCertificate()
+	s := &Server{
+		implicitTLS: implicitTLS,
+		tlsConfig:   &tls.Config{Certificates: []tls.Certificate{tlsCertificate}},
+		certificate: certificate,
+		received:    make(chan struct{}, 1),
+		conns:       make(map[net.Conn]struct{}),
+	}
+	var err error
+	if implicitTLS {
+		s.listener, err = tls.Listen("tcp", "127.0.0.1:0", s.tlsConfig)
+	} else {
+		s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		panic(fmt.Sprintf("smtptest: failed to listen: %v", err))
+	}
+	s.Host, s.Port, _ = net.SplitHostPort(s.listener.Addr().String())
+
+	s.waitGroup.Add(1)
+	go s.serve()
+	return s
+}
+
+// RequireAuth makes the server refuse mail from clients which have not authenticated as username with password.
+func (s *Server) RequireAuth(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username = username
+	s.password = password
+}
+
+// FailNext makes the server turn down the next n messages with a temporary error, as a busy server would.
+func (s *Server) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext = n
+}
+
+// Messages returns the messages received so far, oldest first.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// WaitForMessages waits until the server has received at least n messages, or the timeout passes, and returns the
+// messages received by then.
+func (s *Server) WaitForMessages(n int, timeout time.Duration) []Message {
+	deadline := time.After(timeout)
+	for {
+		messages := s.Messages()
+		if len(messages) >= n {
+			return messages
+		}
+		select {
+		case <-s.received:
+		case <-deadline:
+			return messages
+		}
+	}
+}
+
+// Config returns the SMTP configuration for sending mail to the server, using the TLS mode it was started with.
+func (s *Server) Config() config.SMTPConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	smtpConfig := config.SMTPConfig{
+		Enabled:  true,
+		Host:     s.Host,
+		Port:     s.Port,
+		Username: s.username,
+		Password: s.password,
+		Auth:     mailer.AuthPlain,
+		TLS:      mailer.TLSStartTLS,
+		From:     "chitchat@example.com",
+	}
+	if s.implicitTLS {
+		smtpConfig.TLS = mailer.TLSImplicit
+	}
+	return smtpConfig
+}
+
+// ClientTLSConfig returns a TLS configuration trusting the server's certificate.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(s.certificate)
+	return &tls.Config{RootCAs: roots, ServerName: s.Host}
+}
+
+// Close stops the server, cutting off any clients still connected.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.waitGroup.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.waitGroup.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.waitGroup.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.waitGroup.Done()
+			s.handle(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// session is the state of a single client connection.
+type session struct {
+	text     *textproto.Conn
+	isTLS    bool
+	username string
+	from     string
+	to       []string
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	c := &session{text: textproto.NewConn(conn), isTLS: s.implicitTLS}
+	c.reply(220, "smtptest ESMTP ready")
+	for {
+		line, err := c.text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			extensions := []string{"smtptest", "8BITMIME", "AUTH PLAIN LOGIN"}
+			if !c.isTLS {
+				extensions = append(extensions, "STARTTLS")
+			}
+			c.replyLines(250, extensions)
+		case "HELO", "NOOP":
+			c.reply(250, "OK")
+		case "STARTTLS":
+			if c.isTLS {
+				c.reply(503, "Already using TLS")
+				continue
+			}
+			c.reply(220, "Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err = tlsConn.Handshake(); err != nil {
+				return
+			}
+			c.text = textproto.NewConn(tlsConn)
+			c.isTLS = true
+			c.reset()
+		case "AUTH":
+			s.authenticate(c, arg)
+		case "MAIL":
+			if s.requiresAuth() && c.username == "" {
+				c.reply(530, "Authentication required")
+				continue
+			}
+			c.from = address(arg, "FROM:")
+			c.reply(250, "OK")
+		case "RCPT":
+			if c.from == "" {
+				c.reply(503, "Need MAIL first")
+				continue
+			}
+			c.to = append(c.to, address(arg, "TO:"))
+			c.reply(250, "OK")
+		case "DATA":
+			if len(c.to) == 0 {
+				c.reply(503, "Need RCPT first")
+				continue
+			}
+			c.reply(354, "End data with <CR><LF>.<CR><LF>")
+			data, err := c.text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			if s.takeFailure() {
+				c.reply(451, "Try again later")
+			} else {
+				s.store(Message{From: c.from, To: c.to, Username: c.username, Data: data})
+				c.reply(250, "OK")
+			}
+			c.reset()
+		case "RSET":
+			c.reset()
+			c.reply(250, "OK")
+		case "QUIT":
+			c.reply(221, "Bye")
+			return
+		default:
+			c.reply(502, "Command not implemented")
+		}
+	}
+}
+
+func (s *Server) authenticate(c *session, arg string) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var username, password string
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		response := initial
+		if response == "" {
+			response = c.challenge("")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(response)
+		parts := strings.Split(string(decoded), "\x00")
+		if err != nil || len(parts) != 3 {
+			c.reply(501, "Malformed PLAIN response")
+			return
+		}
+		username, password = parts[1], parts[2]
+	case "LOGIN":
+		username = decode(c.challenge("Username:"))
+		password = decode(c.challenge("Password:"))
+	default:
+		c.reply(504, "Unsupported mechanism")
+		return
+	}
+
+	s.mu.Lock()
+	valid := s.username != "" && username == s.username && password == s.password
+	s.mu.Unlock()
+	if !valid {
+		c.reply(535, "Authentication failed")
+		return
+	}
+	c.username = username
+	c.reply(235, "Authentication succeeded")
+}
+
+func (s *Server) requiresAuth() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.username != ""
+}
+
+func (s *Server) takeFailure() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failNext > 0 {
+		s.failNext--
+		return true
+	}
+	return false
+}
+
+func (s *Server) store(message Message) {
+	s.mu.Lock()
+	s.messages = append(s.messages, message)
+	s.mu.Unlock()
+	select {
+	case s.received <- struct{}{}:
+	default:
+	}
+}
+
+func (c *session) reply(code int, message string) {
+	_ = c.text.PrintfLine("%d %s", code, message)
+}
+
+func (c *session) replyLines(code int, lines []string) {
+	for i, line := range lines {
+		separator := "-"
+		if i == len(lines)-1 {
+			separator = " "
+		}
+		_ = c.text.PrintfLine("%d%s%s", code, separator, line)
+	}
+}
+
+// challenge sends the prompt, base64 encoded as SASL wants it, and returns the client's response.
+func (c *session) challenge(prompt string) string {
+	c.reply(334, base64.StdEncoding.EncodeToString([]byte(prompt)))
+	response, _ := c.text.ReadLine()
+	return response
+}
+
+func (c *session) reset() {
+	c.from = ""
+	c.to = nil
+}
+
+func decode(response string) string {
+	decoded, _ := base64.StdEncoding.DecodeString(response)
+	return string(decoded)
+}
+
+// address takes the address out of arguments like "FROM:<someone@example.com> BODY=8BITMIME".
+func address(arg, prefix string) string {
+	arg = strings.TrimSpace(arg)
+	if len(arg) >= len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+		arg = arg[len(prefix):]
+	}
+	arg, _, _ = strings.Cut(arg, " ")
+	return strings.Trim(arg, "<>")
+}
+
+// newCertificate makes a self-signed certificate for 127.0.0.1 and localhost.
+func newCertificate() (*x509.Certificate, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("smtptest: failed to generate key: %v", err))
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"smtptest"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(fmt.Sprintf("smtptest: failed to create certificate: %v", err))
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(fmt.Sprintf("smtptest: failed to parse certificate: %v", err))
+	}
+	return certificate, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: certificate}
+}
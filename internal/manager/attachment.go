@@ -0,0 +1,250 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/emilhauk/chitchat/internal/blob"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/google/uuid"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type AttachmentBackend interface {
+	FindByUUID(uuid string) (model.Attachment, error)
+	FindForMessages(messageUUIDs ...string) ([]model.Attachment, error)
+}
+
+const (
+	// thumbnailSize is the longest side of a thumbnail, in pixels
+	thumbnailSize = 320
+	// maxThumbnailSourcePixels keeps images that decompress into something enormous from being decoded at all
+	maxThumbnailSourcePixels = 40_000_000
+	maxFileNameLength        = 255
+)
+
+type Attachment struct {
+	attachmentBackend AttachmentBackend
+	blobStore         blob.Store
+}
+
+func NewAttachmentManager(attachmentBackend AttachmentBackend, blobStore blob.Store) Attachment {
+	return Attachment{
+		attachmentBackend: attachmentBackend,
+		blobStore:         blobStore,
+	}
+}
+
+// Store keeps the content of the uploads for attaching them to a message in the channel. Images get a thumbnail as
+// well, if one can be made. The attachments are stored along with the message they are attached to, and should that
+// fail, be discarded. If storing any of the uploads fails, none of them are kept.
+func (m Attachment) Store(channelUUID string, uploads ...model.Upload) ([]model.Attachment, error) {
+	attachments := make([]model.Attachment, 0, len(uploads))
+	for _, upload := range uploads {
+		attachment, err := m.store(channelUUID, upload)
+		if err != nil {
+			_ = m.Discard(append(attachments, attachment)...)
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+// Discard removes the content of attachments no message came to refer to.
+func (m Attachment) Discard(attachments ...model.Attachment) error {
+	errs := make([]error, 0)
+	for _, attachment := range attachments {
+		errs = append(errs, m.blobStore.Delete(attachment.StorageKey))
+		if attachment.ThumbnailKey != nil {
+			errs = append(errs, m.blobStore.Delete(*attachment.ThumbnailKey))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m Attachment) store(channelUUID string, upload model.Upload) (model.Attachment, error) {
+	attachment := model.Attachment{
+		UUID:        uuid.NewString(),
+		ChannelUUID: channelUUID,
+		FileName:    cleanFileName(upload.FileName),
+		Size:        upload.Size,
+		CreatedAt:   time.Now(),
+	}
+	attachment.StorageKey = fmt.Sprintf("attachments/%s/%s", attachment.ChannelUUID, attachment.UUID)
+
+	contentType, err := detectContentType(upload.Content)
+	if err != nil {
+		return attachment, err
+	}
+	attachment.ContentType = contentType
+
+	err = m.blobStore.Put(attachment.StorageKey, upload.Content, upload.Size, contentType)
+	if err != nil {
+		return attachment, err
+	}
+
+	if attachment.IsImage() {
+		if _, err = upload.Content.Seek(0, io.SeekStart); err != nil {
+			return attachment, err
+		}
+		thumbnail, thumbnailType, err := makeThumbnail(upload.Content, contentType)
+		// Images that can't be made a thumbnail of are still fine as attachments
+		if err == nil {
+			thumbnailKey := attachment.StorageKey + "/thumbnail"
+			err = m.blobStore.Put(thumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), thumbnailType)
+			if err != nil {
+				return attachment, err
+			}
+			attachment.ThumbnailKey = &thumbnailKey
+		}
+	}
+
+	return attachment, nil
+}
+
+func (m Attachment) FindByUUID(uuid string) (model.Attachment, error) {
+	return m.attachmentBackend.FindByUUID(uuid)
+}
+
+// FindForMessages returns attachments by the UUID of the message they are attached to.
+func (m Attachment) FindForMessages(messageUUIDs ...string) (map[string][]model.Attachment, error) {
+	attachmentsByMessage := map[string][]model.Attachment{}
+	attachments, err := m.attachmentBackend.FindForMessages(messageUUIDs...)
+	if err != nil {
+		return attachmentsByMessage, err
+	}
+	for _, attachment := range attachments {
+		attachmentsByMessage[attachment.MessageUUID] = append(attachmentsByMessage[attachment.MessageUUID], attachment)
+	}
+	return attachmentsByMessage, nil
+}
+
+// Open returns the content of the attachment, or of its thumbnail. The caller must close it.
+func (m Attachment) Open(attachment model.Attachment, thumbnail bool) (io.ReadCloser, error) {
+	if thumbnail {
+		return m.blobStore.Get(*attachment.ThumbnailKey)
+	}
+	return m.blobStore.Get(attachment.StorageKey)
+}
+
+func detectContentType(content io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	contentType := http.DetectContentType(head[:n])
+	// Parameters, like charset, are of no use to anyone downloading the file
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return contentType, nil
+}
+
+// cleanFileName keeps only the base name of what the uploader called the file, without anything that would be
+// troublesome in a header or a file system.
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	for len(name) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// makeThumbnail scales the image down to fit within thumbnailSize. JPEGs stay JPEGs, anything else becomes a PNG.
+func makeThumbnail(content io.ReadSeeker, contentType string) ([]byte, string, error) {
+	source, err := decodeImage(content)
+	if err != nil {
+		return nil, "", err
+	}
+
+	thumbnail := scaleDown(source, thumbnailSize)
+	buf := bytes.Buffer{}
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 80})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&buf, thumbnail)
+	return buf.Bytes(), "image/png", err
+}
+
+// decodeImage decodes the image, unless it is too large to be scaled down.
+func decodeImage(content io.ReadSeeker) (image.Image, error) {
+	config, _, err := image.DecodeConfig(content)
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxThumbnailSourcePixels {
+		return nil, fmt.Errorf("image of %dx%d is too large to scale down", config.Width, config.Height)
+	}
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	source, _, err := image.Decode(content)
+	return source, err
+}
+
+// scaleDown fits the image within size by averaging each box of source pixels making up a thumbnail pixel. Images
+// that already fit are only copied.
+func scaleDown(source image.Image, size int) image.Image {
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/bounds.Dx())
+		} else {
+			width, height = max(1, width*size/bounds.Dy()), size
+		}
+	}
+
+	thumbnail := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := source.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			// Premultiplied sums are turned back into straight colors, as NRGBA wants
+			pixel := color.NRGBA{}
+			if a > 0 {
+				pixel = color.NRGBA{
+					R: uint8(r * 0xff / a),
+					G: uint8(g * 0xff / a),
+					B: uint8(b * 0xff / a),
+					A: uint8(a / n >> 8),
+				}
+			}
+			thumbnail.SetNRGBA(x, y, pixel)
+		}
+	}
+	return thumbnail
+}
@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/blob"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/google/uuid"
+	"image/png"
+	"io"
+	"slices"
+)
+
+// avatarSize is the longest side of an avatar, in pixels
+const avatarSize = 256
+
+type Avatar struct {
+	blobStore blob.Store
+}
+
+func NewAvatarManager(blobStore blob.Store) Avatar {
+	return Avatar{
+		blobStore: blobStore,
+	}
+}
+
+// StoreForChannel scales the uploaded image down to an avatar for the channel, and stores it as a PNG. The key it is
+// stored under is returned, and is different for every avatar stored. Uploads which are not images fail with
+// app.ErrUnsupportedImage.
+func (m Avatar) StoreForChannel(channel model.Channel, upload model.Upload) (string, error) {
+	contentType, err := detectContentType(upload.Content)
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(model.ThumbnailContentTypes, contentType) {
+		return "", app.ErrUnsupportedImage
+	}
+	source, err := decodeImage(upload.Content)
+	if err != nil {
+		return "", app.ErrUnsupportedImage
+	}
+	buf := bytes.Buffer{}
+	err = png.Encode(&buf, scaleDown(source, avatarSize))
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("channels/%s/avatar/%s", channel.UUID, uuid.NewString())
+	return key, m.blobStore.Put(key, &buf, int64(buf.Len()), "image/png")
+}
+
+// Open returns the avatar stored under key. The caller must close it.
+func (m Avatar) Open(key string) (io.ReadCloser, error) {
+	return m.blobStore.Get(key)
+}
+
+func (m Avatar) Delete(key string) error {
+	return m.blobStore.Delete(key)
+}
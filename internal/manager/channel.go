@@ -1,6 +1,8 @@
 package manager
 
 import (
+	"errors"
+	app "github.com/emilhauk/chitchat/internal"
 	"github.com/emilhauk/chitchat/internal/model"
 	"github.com/google/uuid"
 	"time"
@@ -8,11 +10,27 @@ import (
 
 type ChannelBackend interface {
 	Create(channel model.Channel) error
+	CreateWithMembers(channel model.Channel, role model.ChannelRole, users ...model.User) error
+	Update(channel model.Channel) error
+	SetArchivedAt(channel model.Channel) error
 	FindByUUID(uuid string) (model.Channel, error)
+	FindDirect(userUUIDs ...string) (model.Channel, error)
 	FindAllForUser(userUUID string) ([]model.Channel, error)
+	FindPublic() ([]model.Channel, error)
 	FindForUser(channelUUID, userUUID string) (model.Channel, error)
 	AddMember(channel model.Channel, user model.User, role model.ChannelRole) error
 	FindMember(channelUUID string, userUUID string) (model.Member, error)
+	FindMembers(channelUUID string) ([]model.Member, error)
+	CountMembersOfChannels(channelUUIDs ...string) (map[string]int, error)
+	FindMemberships(userUUID string) (map[string]model.Member, error)
+	FindMemberUUIDsOfChannels(channelUUIDs ...string) (map[string][]string, error)
+	RemoveMember(channelUUID, userUUID string) error
+	SetRole(channelUUID, userUUID string, role model.ChannelRole) error
+	SetNotify(channelUUID, userUUID string, notify model.NotifyLevel, mutedUntil *time.Time) error
+	SetFavourite(channelUUID, userUUID string, isFavourite bool) error
+	SetSortOrder(userUUID string, channelUUIDs []string) error
+	FindContacts(userUUID string) ([]string, error)
+	MarkRead(channelUUID, userUUID, messageUUID string) (bool, error)
 }
 
 type Channel struct {
@@ -27,21 +45,77 @@ func NewChannelManager(channelBackend ChannelBackend) Channel {
 
 func (m Channel) Create(name string, user model.User) (model.Channel, error) {
 	channel := model.Channel{
-		UUID:      uuid.NewString(),
-		Name:      name,
-		CreatedAt: time.Now(),
+		UUID:       uuid.NewString(),
+		Name:       name,
+		Kind:       model.ChannelKindGroup,
+		Visibility: model.VisibilityPrivate,
+		CreatedAt:  time.Now(),
 	}
 	err := m.channelBackend.Create(channel)
 	if err == nil {
-		err = m.channelBackend.AddMember(channel, user, model.RoleAdmin)
+		err = m.channelBackend.AddMember(channel, user, model.RoleOwner)
 	}
 	return channel, err
 }
 
-func (m Channel) GetChannelListForUser(userUUID string) ([]model.Channel, error) {
+// Update stores the channel's settings, and when they were changed.
+func (m Channel) Update(channel model.Channel) (model.Channel, error) {
+	now := time.Now()
+	channel.UpdatedAt = &now
+	return channel, m.channelBackend.Update(channel)
+}
+
+// Archive keeps the channel for reading only, from now on.
+func (m Channel) Archive(channel model.Channel) (model.Channel, error) {
+	now := time.Now()
+	channel.ArchivedAt = &now
+	channel.UpdatedAt = &now
+	return channel, m.channelBackend.SetArchivedAt(channel)
+}
+
+// Unarchive brings the archived channel back into use.
+func (m Channel) Unarchive(channel model.Channel) (model.Channel, error) {
+	now := time.Now()
+	channel.ArchivedAt = nil
+	channel.UpdatedAt = &now
+	return channel, m.channelBackend.SetArchivedAt(channel)
+}
+
+// GetOrCreateDirect returns the direct channel between the users, which is created if they have none yet.
+func (m Channel) GetOrCreateDirect(user, other model.User) (model.Channel, error) {
+	channel, err := m.channelBackend.FindDirect(user.UUID, other.UUID)
+	if !errors.Is(err, app.ErrChannelNotFound) {
+		return channel, err
+	}
+	channel = model.Channel{
+		UUID:            uuid.NewString(),
+		Kind:            model.ChannelKindDirect,
+		Visibility:      model.VisibilityPrivate,
+		DirectUserUUIDs: []string{user.UUID, other.UUID},
+		CreatedAt:       time.Now(),
+	}
+	// Both are equals in a direct conversation
+	err = m.channelBackend.CreateWithMembers(channel, model.RoleAdmin, user, other)
+	if err != nil {
+		// Both may have started the conversation at the same time, in which case the other one won. Creating the channel
+		// waits for the winner to finish, so by now the winner's channel has both members.
+		if existing, findErr := m.channelBackend.FindDirect(user.UUID, other.UUID); findErr == nil {
+			return existing, nil
+		}
+		return channel, err
+	}
+	return channel, nil
+}
+
+func (m Channel) GetChannelListForUser(userUUID string) (model.ChannelList, error) {
 	return m.channelBackend.FindAllForUser(userUUID)
 }
 
+// GetPublicChannels returns the channels anyone may join, unless archived.
+func (m Channel) GetPublicChannels() ([]model.Channel, error) {
+	return m.channelBackend.FindPublic()
+}
+
 func (m Channel) GetChannelForUser(channelUUID, userUUID string) (model.Channel, error) {
 	return m.channelBackend.FindForUser(channelUUID, userUUID)
 }
@@ -50,6 +124,30 @@ func (m Channel) GetMemberInfo(channelUUID, userUUID string) (model.Member, erro
 	return m.channelBackend.FindMember(channelUUID, userUUID)
 }
 
+func (m Channel) GetMembers(channelUUID string) ([]model.Member, error) {
+	return m.channelBackend.FindMembers(channelUUID)
+}
+
+// CountMembersOfChannels returns the number of members of each of the channels, by channel UUID.
+func (m Channel) CountMembersOfChannels(channelUUIDs ...string) (map[string]int, error) {
+	return m.channelBackend.CountMembersOfChannels(channelUUIDs...)
+}
+
+// GetMemberships returns the user's membership of each of the user's channels, by channel UUID.
+func (m Channel) GetMemberships(userUUID string) (map[string]model.Member, error) {
+	return m.channelBackend.FindMemberships(userUUID)
+}
+
+// GetMemberUUIDsOfChannels returns the UUIDs of the members of each of the channels, by channel UUID.
+func (m Channel) GetMemberUUIDsOfChannels(channelUUIDs ...string) (map[string][]string, error) {
+	return m.channelBackend.FindMemberUUIDsOfChannels(channelUUIDs...)
+}
+
+// GetContacts returns the UUIDs of the users sharing a channel with the user, including the user itself.
+func (m Channel) GetContacts(userUUID string) ([]string, error) {
+	return m.channelBackend.FindContacts(userUUID)
+}
+
 func (m Channel) FindByUUID(channelUUID string) (model.Channel, error) {
 	return m.channelBackend.FindByUUID(channelUUID)
 }
@@ -57,3 +155,34 @@ func (m Channel) FindByUUID(channelUUID string) (model.Channel, error) {
 func (m Channel) AddMember(channel model.Channel, user model.User, role model.ChannelRole) error {
 	return m.channelBackend.AddMember(channel, user, role)
 }
+
+// RemoveMember takes the user out of the channel, or fails with app.ErrLastOwner if that would leave others in the
+// channel without an owner.
+func (m Channel) RemoveMember(channelUUID, userUUID string) error {
+	return m.channelBackend.RemoveMember(channelUUID, userUUID)
+}
+
+// SetRole gives the member a new role, or fails with app.ErrLastOwner if that would leave the channel without an owner.
+func (m Channel) SetRole(channelUUID, userUUID string, role model.ChannelRole) error {
+	return m.channelBackend.SetRole(channelUUID, userUUID, role)
+}
+
+// SetNotify sets what the member is notified of in the channel. Muting lasts until mutedUntil, unless nil.
+func (m Channel) SetNotify(channelUUID, userUUID string, notify model.NotifyLevel, mutedUntil *time.Time) error {
+	return m.channelBackend.SetNotify(channelUUID, userUUID, notify, mutedUntil)
+}
+
+func (m Channel) SetFavourite(channelUUID, userUUID string, isFavourite bool) error {
+	return m.channelBackend.SetFavourite(channelUUID, userUUID, isFavourite)
+}
+
+// SetSortOrder places the user's channels in the order given.
+func (m Channel) SetSortOrder(userUUID string, channelUUIDs []string) error {
+	return m.channelBackend.SetSortOrder(userUUID, channelUUIDs)
+}
+
+// MarkRead records that the user has seen the channel history up to and including the message, and tells whether this
+// moved the user's read marker.
+func (m Channel) MarkRead(channelUUID, userUUID, messageUUID string) (bool, error) {
+	return m.channelBackend.MarkRead(channelUUID, userUUID, messageUUID)
+}
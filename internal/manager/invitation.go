@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"github.com/emilhauk/chitchat/internal/model"
+	"strings"
+	"time"
+)
+
+type InvitationBackend interface {
+	Create(invitation model.Invitation) error
+	FindByCode(code string) (model.Invitation, error)
+	FindForChannel(channelUUID string) ([]model.Invitation, error)
+	Use(code string, at time.Time) (bool, error)
+	Revoke(channelUUID, code string, at time.Time) (bool, error)
+}
+
+// invitationCodeBytes is how much randomness goes into an invitation code, which is too much to ever be guessed
+const invitationCodeBytes = 15
+
+type Invitation struct {
+	invitationBackend InvitationBackend
+}
+
+func NewInvitationManager(invitationBackend InvitationBackend) Invitation {
+	return Invitation{
+		invitationBackend: invitationBackend,
+	}
+}
+
+// Create makes a new invitation to the channel. It expires after expiresIn and may be used maxUses times, unless
+// either is zero.
+func (m Invitation) Create(channel model.Channel, user model.User, expiresIn time.Duration, maxUses int) (model.Invitation, error) {
+	code, err := generateInvitationCode()
+	if err != nil {
+		return model.Invitation{}, err
+	}
+	invitation := model.Invitation{
+		Code:        code,
+		ChannelUUID: channel.UUID,
+		CreatedBy:   user,
+		CreatedAt:   time.Now(),
+	}
+	if expiresIn > 0 {
+		expiresAt := invitation.CreatedAt.Add(expiresIn)
+		invitation.ExpiresAt = &expiresAt
+	}
+	if maxUses > 0 {
+		invitation.MaxUses = &maxUses
+	}
+	return invitation, m.invitationBackend.Create(invitation)
+}
+
+func (m Invitation) FindByCode(code string) (model.Invitation, error) {
+	return m.invitationBackend.FindByCode(code)
+}
+
+// FindForChannel returns the invitations to the channel which are not revoked, newest first.
+func (m Invitation) FindForChannel(channelUUID string) ([]model.Invitation, error) {
+	return m.invitationBackend.FindForChannel(channelUUID)
+}
+
+// Use counts a use of the invitation, and tells whether it was still usable.
+func (m Invitation) Use(invitation model.Invitation) (bool, error) {
+	return m.invitationBackend.Use(invitation.Code, time.Now())
+}
+
+// Revoke stops the invitation to the channel from being used, and tells whether there was anything to revoke.
+func (m Invitation) Revoke(channelUUID, code string) (bool, error) {
+	return m.invitationBackend.Revoke(channelUUID, code, time.Now())
+}
+
+func generateInvitationCode() (string, error) {
+	buffer := make([]byte, invitationCodeBytes)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(buffer)), nil
+}
@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"github.com/emilhauk/chitchat/internal/model"
+)
+
+type MentionBackend interface {
+	Create(messageUUID string, userUUIDs ...string) error
+	DeleteForMessage(messageUUID string) error
+	FindForMessages(messageUUIDs ...string) (map[string][]string, error)
+}
+
+type Mention struct {
+	mentionBackend MentionBackend
+}
+
+func NewMentionManager(mentionBackend MentionBackend) Mention {
+	return Mention{
+		mentionBackend: mentionBackend,
+	}
+}
+
+// Record stores the mentions of message.
+func (m Mention) Record(message model.Message) error {
+	return m.mentionBackend.Create(message.UUID, userUUIDs(message.Mentions)...)
+}
+
+// Replace stores the mentions of message in place of those previously stored, typically after it has been edited.
+// The users who were not mentioned before are returned.
+func (m Mention) Replace(message model.Message) ([]model.User, error) {
+	added := make([]model.User, 0)
+	previous, err := m.mentionBackend.FindForMessages(message.UUID)
+	if err != nil {
+		return added, err
+	}
+	wasMentioned := map[string]bool{}
+	for _, userUUID := range previous[message.UUID] {
+		wasMentioned[userUUID] = true
+	}
+	for _, user := range message.Mentions {
+		if !wasMentioned[user.UUID] {
+			added = append(added, user)
+		}
+	}
+
+	err = m.mentionBackend.DeleteForMessage(message.UUID)
+	if err != nil {
+		return added, err
+	}
+	return added, m.Record(message)
+}
+
+// FindForMessages returns the UUIDs of mentioned users by the UUID of the message mentioning them.
+func (m Mention) FindForMessages(messageUUIDs ...string) (map[string][]string, error) {
+	return m.mentionBackend.FindForMessages(messageUUIDs...)
+}
+
+func userUUIDs(users []model.User) []string {
+	uuids := make([]string, 0, len(users))
+	for _, user := range users {
+		uuids = append(uuids, user.UUID)
+	}
+	return uuids
+}
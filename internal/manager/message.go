@@ -1,6 +1,7 @@
 package manager
 
 import (
+	app "github.com/emilhauk/chitchat/internal"
 	"github.com/emilhauk/chitchat/internal/model"
 	"github.com/google/uuid"
 	"time"
@@ -8,10 +9,24 @@ import (
 
 type MessageBackend interface {
 	Create(channelUUID string, message model.Message) error
-	FindForChannel(channelUUID string, limit, offset int32) ([]model.Message, error)
+	FindByUUID(channelUUID, messageUUID string) (model.Message, error)
+	FindByUUIDs(channelUUID string, messageUUIDs ...string) (map[string]model.Message, error)
+	FindLatestForChannel(channelUUID string, limit int32) ([]model.Message, error)
+	FindForChannelBefore(channelUUID string, cursor model.Message, limit int32) ([]model.Message, error)
+	FindForChannelAfter(channelUUID string, cursor model.Message, limit int32) ([]model.Message, error)
 	FindLastMessageForChannels(channelUUIDs ...string) ([]model.Message, error)
+	FindReplies(parentUUID string) ([]model.Message, error)
+	FindMentioning(userUUID string, limit int32) ([]model.Message, error)
+	Search(userUUID string, query model.SearchQuery, limit int32) ([]model.Message, error)
+	CountReplies(parentUUIDs ...string) (map[string]int, error)
+	CountUnread(userUUID string) (map[string]int, error)
+	Update(message model.Message, previous model.MessageVersion) error
+	MarkDeleted(uuid string, deletedAt time.Time) error
+	FindVersions(messageUUID string) ([]model.MessageVersion, error)
 }
 
+const messagePageSize = 50
+
 type Message struct {
 	messageBackend MessageBackend
 }
@@ -24,18 +39,173 @@ func NewMessageManager(messageBackend MessageBackend) Message {
 
 func (m Message) Send(channel model.Channel, message model.Message) (model.Message, error) {
 	message.UUID = uuid.NewString()
+	message.ChannelUUID = channel.UUID
 	message.Version = 1
 	message.SentAt = time.Now()
 	message.Direction = model.DirectionOut
+	for i := range message.Attachments {
+		message.Attachments[i].MessageUUID = message.UUID
+	}
 
 	err := m.messageBackend.Create(channel.UUID, message)
 	return message, err
 }
 
-func (m Message) FindMessagesForChannel(channelUUID string) ([]model.Message, error) {
-	return m.messageBackend.FindForChannel(channelUUID, 100, 0)
+// Edit replaces the content of message and bumps its version. The replaced content is kept as a MessageVersion.
+func (m Message) Edit(message model.Message, content string) (model.Message, error) {
+	previous := model.MessageVersion{
+		MessageUUID: message.UUID,
+		Version:     message.Version,
+		Content:     message.Content,
+		CreatedAt:   message.SentAt,
+	}
+	if message.UpdatedAt != nil {
+		previous.CreatedAt = *message.UpdatedAt
+	}
+
+	now := time.Now()
+	message.Content = content
+	message.Version++
+	message.UpdatedAt = &now
+
+	err := m.messageBackend.Update(message, previous)
+	return message, err
+}
+
+// Delete soft-deletes message. Content and versions are kept in storage, but must not be shown to anyone.
+func (m Message) Delete(message model.Message) (model.Message, error) {
+	now := time.Now()
+	message.DeletedAt = &now
+	err := m.messageBackend.MarkDeleted(message.UUID, now)
+	return message, err
+}
+
+func (m Message) FindByUUID(channelUUID, messageUUID string) (model.Message, error) {
+	return m.messageBackend.FindByUUID(channelUUID, messageUUID)
+}
+
+// FindByUUIDs returns the messages of the channel which are found, by UUID.
+func (m Message) FindByUUIDs(channelUUID string, messageUUIDs ...string) (map[string]model.Message, error) {
+	return m.messageBackend.FindByUUIDs(channelUUID, messageUUIDs...)
+}
+
+// FindMessagesForChannel returns the latest page of messages in the channel.
+func (m Message) FindMessagesForChannel(channelUUID string) (model.MessagePage, error) {
+	page := model.MessagePage{ChannelUUID: channelUUID}
+	// Ask for one more than we need, to know whether there is anything beyond this page
+	messages, err := m.messageBackend.FindLatestForChannel(channelUUID, messagePageSize+1)
+	if err != nil {
+		return page, err
+	}
+	if len(messages) > messagePageSize {
+		page.HasOlder = true
+		messages = messages[1:]
+	}
+	page.Messages = messages
+	return page, nil
+}
+
+// FindMessagesBefore returns the page of messages sent right before the message with messageUUID.
+func (m Message) FindMessagesBefore(channelUUID, messageUUID string) (model.MessagePage, error) {
+	page := model.MessagePage{ChannelUUID: channelUUID}
+	cursor, err := m.messageBackend.FindByUUID(channelUUID, messageUUID)
+	if err != nil {
+		return page, err
+	}
+	messages, err := m.messageBackend.FindForChannelBefore(channelUUID, cursor, messagePageSize+1)
+	if err != nil {
+		return page, err
+	}
+	if len(messages) > messagePageSize {
+		page.HasOlder = true
+		messages = messages[1:]
+	}
+	page.Messages = messages
+	return page, nil
+}
+
+// FindMessagesAfter returns the page of messages sent right after the message with messageUUID.
+func (m Message) FindMessagesAfter(channelUUID, messageUUID string) (model.MessagePage, error) {
+	page := model.MessagePage{ChannelUUID: channelUUID}
+	cursor, err := m.messageBackend.FindByUUID(channelUUID, messageUUID)
+	if err != nil {
+		return page, err
+	}
+	messages, err := m.messageBackend.FindForChannelAfter(channelUUID, cursor, messagePageSize+1)
+	if err != nil {
+		return page, err
+	}
+	if len(messages) > messagePageSize {
+		page.HasNewer = true
+		messages = messages[:messagePageSize]
+	}
+	page.Messages = messages
+	return page, nil
+}
+
+// FindMessagesAround returns the page of messages with the message with messageUUID in the middle.
+func (m Message) FindMessagesAround(channelUUID, messageUUID string) (model.MessagePage, error) {
+	page := model.MessagePage{ChannelUUID: channelUUID}
+	cursor, err := m.messageBackend.FindByUUID(channelUUID, messageUUID)
+	if err != nil {
+		return page, err
+	}
+	if cursor.IsReply() {
+		// Replies are not part of the channel history
+		return page, app.ErrMessageNotFound
+	}
+	half := int32(messagePageSize / 2)
+	older, err := m.messageBackend.FindForChannelBefore(channelUUID, cursor, half+1)
+	if err != nil {
+		return page, err
+	}
+	if len(older) > int(half) {
+		page.HasOlder = true
+		older = older[1:]
+	}
+	newer, err := m.messageBackend.FindForChannelAfter(channelUUID, cursor, half+1)
+	if err != nil {
+		return page, err
+	}
+	if len(newer) > int(half) {
+		page.HasNewer = true
+		newer = newer[:half]
+	}
+	page.Messages = append(append(older, cursor), newer...)
+	return page, nil
 }
 
 func (m Message) FindLastMessageForChannels(channelUUIDs ...string) ([]model.Message, error) {
 	return m.messageBackend.FindLastMessageForChannels(channelUUIDs...)
 }
+
+func (m Message) FindReplies(parentUUID string) ([]model.Message, error) {
+	return m.messageBackend.FindReplies(parentUUID)
+}
+
+// FindMentioning returns the latest messages mentioning the user, newest first.
+func (m Message) FindMentioning(userUUID string) ([]model.Message, error) {
+	return m.messageBackend.FindMentioning(userUUID, messagePageSize)
+}
+
+// Search returns the newest messages matching the query in channels the user is a member of, newest first. There are
+// more matches if more than messagePageSize are returned.
+func (m Message) Search(userUUID string, query model.SearchQuery) ([]model.Message, bool, error) {
+	messages, err := m.messageBackend.Search(userUUID, query, messagePageSize+1)
+	if len(messages) > messagePageSize {
+		return messages[:messagePageSize], true, err
+	}
+	return messages, false, err
+}
+
+func (m Message) CountReplies(parentUUIDs ...string) (map[string]int, error) {
+	return m.messageBackend.CountReplies(parentUUIDs...)
+}
+
+func (m Message) CountUnread(userUUID string) (map[string]int, error) {
+	return m.messageBackend.CountUnread(userUUID)
+}
+
+func (m Message) FindVersions(messageUUID string) ([]model.MessageVersion, error) {
+	return m.messageBackend.FindVersions(messageUUID)
+}
@@ -0,0 +1,156 @@
+package manager
+
+import (
+	"context"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	// outboxBatchSize is how many mails are sent in one go, before looking for more
+	outboxBatchSize = 20
+	// outboxMaxAttempts is how many times sending a mail may fail before giving up on it
+	outboxMaxAttempts = 10
+	// outboxPollInterval is how often the outbox is checked for mails due to be retried
+	outboxPollInterval = 30 * time.Second
+	// outboxKeepSent is how long sent mails are kept, for troubleshooting
+	outboxKeepSent = 24 * time.Hour
+	// lastErrorMaxLength is the length of mail_outbox.last_error, in characters
+	lastErrorMaxLength = 1024
+)
+
+type OutboxBackend interface {
+	Create(mail model.Mail) error
+	FindDue(now time.Time, maxAttempts, limit int) ([]model.Mail, error)
+	MarkSent(mail model.Mail) error
+	MarkFailed(mail model.Mail) error
+	DeleteSentBefore(threshold time.Time) error
+}
+
+type MailSender interface {
+	Send(mail model.Mail) error
+}
+
+// Outbox keeps mails until they are sent. Mails are put in the outbox with Enqueue, and sent by Run.
+type Outbox struct {
+	outboxBackend OutboxBackend
+	sender        MailSender
+	// pending wakes Run up when there's new mail to send
+	pending chan struct{}
+}
+
+func NewOutboxManager(outboxBackend OutboxBackend, sender MailSender) Outbox {
+	return Outbox{
+		outboxBackend: outboxBackend,
+		sender:        sender,
+		pending:       make(chan struct{}, 1),
+	}
+}
+
+// Enqueue puts the mail in the outbox, to be sent right away.
+func (m Outbox) Enqueue(mail model.Mail) (model.Mail, error) {
+	now := time.Now()
+	mail.UUID = uuid.NewString()
+	mail.CreatedAt = now
+	mail.NextAttemptAt = now
+	err := m.outboxBackend.Create(mail)
+	if err == nil {
+		m.wake()
+	}
+	return mail, err
+}
+
+// Run sends the mails in the outbox until ctx is done, including those left from before a restart. Mails failing to
+// send are retried later, waiting longer after each attempt, until they have failed outboxMaxAttempts times.
+func (m Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		m.SendDue(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.pending:
+		}
+	}
+}
+
+// SendDue sends the mails which are due at now, and returns how many were sent.
+func (m Outbox) SendDue(now time.Time) int {
+	mails, err := m.outboxBackend.FindDue(now, outboxMaxAttempts, outboxBatchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to find mails due to be sent")
+		return 0
+	}
+	sent := 0
+	for _, mail := range mails {
+		if m.send(mail, now) {
+			sent++
+		}
+	}
+	if len(mails) == outboxBatchSize {
+		// There may be more where these came from
+		m.wake()
+	}
+
+	if err = m.outboxBackend.DeleteSentBefore(now.Add(-outboxKeepSent)); err != nil {
+		log.Error().Err(err).Msg("Failed to delete old mails from the outbox")
+	}
+	return sent
+}
+
+func (m Outbox) send(mail model.Mail, now time.Time) bool {
+	log := log.With().Str("mail", mail.UUID).Int("attempt", mail.Attempts+1).Logger()
+	err := m.sender.Send(mail)
+	if err == nil {
+		mail.SentAt = &now
+		if err = m.outboxBackend.MarkSent(mail); err != nil {
+			// It would be sent again, rather than not at all
+			log.Error().Err(err).Msg("Mail was sent, but failed to mark it sent")
+		}
+		return true
+	}
+
+	mail.Attempts++
+	mail.LastError = truncate(err.Error(), lastErrorMaxLength)
+	mail.NextAttemptAt = now.Add(outboxRetryDelay(mail.Attempts))
+	if mail.Attempts >= outboxMaxAttempts {
+		log.Error().Err(err).Msg("Failed to send mail. Giving up on it")
+	} else {
+		log.Warn().Err(err).Time("retryAt", mail.NextAttemptAt).Msg("Failed to send mail. Will try again")
+	}
+	if err = m.outboxBackend.MarkFailed(mail); err != nil {
+		log.Error().Err(err).Msg("Failed to record failure to send mail")
+	}
+	return false
+}
+
+func (m Outbox) wake() {
+	select {
+	case m.pending <- struct{}{}:
+	default:
+	}
+}
+
+// outboxRetryDelay is how long to wait before trying again after the given number of failed attempts. It doubles with
+// every attempt, from a minute up to an hour.
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour)
+}
+
+// truncate cuts s down to at most length characters, never in the middle of one.
+func truncate(s string, length int) string {
+	for i := range s {
+		if length == 0 {
+			return s[:i]
+		}
+		length--
+	}
+	return s
+}
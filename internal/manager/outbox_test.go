@@ -0,0 +1,238 @@
+package manager
+
+import (
+	"context"
+	"github.com/emilhauk/chitchat/internal/mailer"
+	"github.com/emilhauk/chitchat/internal/mailer/smtptest"
+	"github.com/emilhauk/chitchat/internal/model"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryOutbox is an OutboxBackend keeping mails in memory, behaving like the mail_outbox table.
+type memoryOutbox struct {
+	mu    sync.Mutex
+	mails map[string]model.Mail
+}
+
+func newMemoryOutbox() *memoryOutbox {
+	return &memoryOutbox{mails: map[string]model.Mail{}}
+}
+
+func (b *memoryOutbox) Create(mail model.Mail) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.mails[mail.UUID] = mail
+	return nil
+}
+
+func (b *memoryOutbox) FindDue(now time.Time, maxAttempts, limit int) ([]model.Mail, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	due := make([]model.Mail, 0)
+	for _, mail := range b.mails {
+		if !mail.IsSent() && !mail.NextAttemptAt.After(now) && mail.Attempts < maxAttempts {
+			due = append(due, mail)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	return due[:min(limit, len(due))], nil
+}
+
+func (b *memoryOutbox) MarkSent(mail model.Mail) error {
+	return b.Create(mail)
+}
+
+func (b *memoryOutbox) MarkFailed(mail model.Mail) error {
+	return b.Create(mail)
+}
+
+func (b *memoryOutbox) DeleteSentBefore(threshold time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for uuid, mail := range b.mails {
+		if mail.IsSent() && mail.SentAt.Before(threshold) {
+			delete(b.mails, uuid)
+		}
+	}
+	return nil
+}
+
+func (b *memoryOutbox) get(uuid string) model.Mail {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.mails[uuid]
+}
+
+func newTestOutbox(t *testing.T, backend OutboxBackend) (Outbox, *smtptest.Server) {
+	server := smtptest.NewServer()
+	t.Cleanup(server.Close)
+	return NewOutboxManager(backend, newTestSender(t, server)), server
+}
+
+func newTestSender(t *testing.T, server *smtptest.Server) MailSender {
+	sender, err := mailer.NewSMTPSender(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender.WithTLSConfig(server.ClientTLSConfig())
+}
+
+func verificationMail(t *testing.T) model.Mail {
+	mail, err := mailer.VerificationCode("someone@example.com", "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mail
+}
+
+func TestOutboxRetriesWithBackoff(t *testing.T) {
+	backend := newMemoryOutbox()
+	outbox, server := newTestOutbox(t, backend)
+	server.FailNext(2)
+
+	mail, err := outbox.Enqueue(verificationMail(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := mail.NextAttemptAt
+
+	if sent := outbox.SendDue(now); sent != 0 {
+		t.Fatalf("sent %d mails, want the first attempt to fail", sent)
+	}
+	failed := backend.get(mail.UUID)
+	if failed.Attempts != 1 || failed.LastError == "" || !failed.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("after the first attempt: attempts=%d lastError=%q retry in %s. Want 1 attempt, retrying in 1m", failed.Attempts, failed.LastError, failed.NextAttemptAt.Sub(now))
+	}
+	if sent := outbox.SendDue(now.Add(30 * time.Second)); sent != 0 || backend.get(mail.UUID).Attempts != 1 {
+		t.Errorf("retried before the mail was due")
+	}
+
+	now = now.Add(time.Minute)
+	if sent := outbox.SendDue(now); sent != 0 {
+		t.Fatalf("sent %d mails, want the second attempt to fail", sent)
+	}
+	failed = backend.get(mail.UUID)
+	if failed.Attempts != 2 || !failed.NextAttemptAt.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("after the second attempt: attempts=%d retry in %s. Want 2 attempts, retrying in 2m", failed.Attempts, failed.NextAttemptAt.Sub(now))
+	}
+
+	now = now.Add(2 * time.Minute)
+	if sent := outbox.SendDue(now); sent != 1 {
+		t.Fatalf("sent %d mails, want the third attempt to succeed", sent)
+	}
+	if !backend.get(mail.UUID).IsSent() {
+		t.Error("mail is not marked sent")
+	}
+	if messages := server.Messages(); len(messages) != 1 || !messages[0].Contains("123456") {
+		t.Errorf("server received %d messages, want the verification mail", len(messages))
+	}
+	if sent := outbox.SendDue(now.Add(time.Hour)); sent != 0 {
+		t.Errorf("sent the mail %d more times", sent)
+	}
+}
+
+func TestOutboxGivesUp(t *testing.T) {
+	backend := newMemoryOutbox()
+	outbox, server := newTestOutbox(t, backend)
+	server.FailNext(outboxMaxAttempts + 1)
+
+	mail, err := outbox.Enqueue(verificationMail(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := mail.NextAttemptAt
+	for attempt := 1; attempt <= outboxMaxAttempts+1; attempt++ {
+		outbox.SendDue(now)
+		now = now.Add(time.Hour)
+	}
+	if attempts := backend.get(mail.UUID).Attempts; attempts != outboxMaxAttempts {
+		t.Errorf("made %d attempts, want %d", attempts, outboxMaxAttempts)
+	}
+}
+
+// TestOutboxSurvivesRestart has sending the mail fail before a restart, and the outbox started after the restart send
+// it once due.
+func TestOutboxSurvivesRestart(t *testing.T) {
+	backend := newMemoryOutbox()
+	before, server := newTestOutbox(t, backend)
+	server.FailNext(1)
+	mail, err := before.Enqueue(verificationMail(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := mail.NextAttemptAt
+	if sent := before.SendDue(now); sent != 0 {
+		t.Fatalf("sent %d mails, want the first attempt to fail", sent)
+	}
+
+	after := NewOutboxManager(backend, newTestSender(t, server))
+	if sent := after.SendDue(now.Add(30 * time.Second)); sent != 0 {
+		t.Errorf("sent %d mails before they were due", sent)
+	}
+	if sent := after.SendDue(now.Add(time.Minute)); sent != 1 {
+		t.Errorf("sent %d mails after restarting, want 1", sent)
+	}
+	if messages := server.Messages(); len(messages) != 1 {
+		t.Errorf("server received %d messages, want 1", len(messages))
+	}
+}
+
+func TestOutboxRun(t *testing.T) {
+	backend := newMemoryOutbox()
+	outbox, server := newTestOutbox(t, backend)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go outbox.Run(ctx)
+
+	for i := 0; i < 3; i++ {
+		if _, err := outbox.Enqueue(verificationMail(t)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if messages := server.WaitForMessages(3, 5*time.Second); len(messages) != 3 {
+		t.Errorf("server received %d messages, want 3", len(messages))
+	}
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Minute},
+		{attempts: 2, want: 2 * time.Minute},
+		{attempts: 3, want: 4 * time.Minute},
+		{attempts: 6, want: 32 * time.Minute},
+		{attempts: 7, want: time.Hour},
+		{attempts: 100, want: time.Hour},
+	}
+	for _, tt := range tests {
+		if got := outboxRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("outboxRetryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exact", 5, "exact"},
+		{"too long", 3, "too"},
+		{"blåbær", 3, "blå"},
+		{"æøå", 2, "æø"},
+		{strings.Repeat("ø", lastErrorMaxLength+1), lastErrorMaxLength, strings.Repeat("ø", lastErrorMaxLength)},
+	}
+	for _, test := range tests {
+		if got := truncate(test.s, test.n); got != test.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", test.s, test.n, got, test.want)
+		}
+	}
+}
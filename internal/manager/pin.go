@@ -0,0 +1,42 @@
+package manager
+
+import (
+	"github.com/emilhauk/chitchat/internal/model"
+	"time"
+)
+
+type PinBackend interface {
+	Create(pin model.Pin) error
+	Delete(channelUUID, messageUUID string) (bool, error)
+	FindForChannel(channelUUID string) ([]model.Pin, error)
+}
+
+type Pin struct {
+	pinBackend PinBackend
+}
+
+func NewPinManager(pinBackend PinBackend) Pin {
+	return Pin{
+		pinBackend: pinBackend,
+	}
+}
+
+// Pin pins the message to its channel. Pinning a message already pinned changes nothing.
+func (m Pin) Pin(message model.Message, user model.User) error {
+	return m.pinBackend.Create(model.Pin{
+		ChannelUUID: message.ChannelUUID,
+		MessageUUID: message.UUID,
+		PinnedBy:    user,
+		PinnedAt:    time.Now(),
+	})
+}
+
+// Unpin removes the message from the pinned messages of its channel, and tells whether it was pinned.
+func (m Pin) Unpin(message model.Message) (bool, error) {
+	return m.pinBackend.Delete(message.ChannelUUID, message.UUID)
+}
+
+// FindForChannel returns the pins of the channel, latest pinned first.
+func (m Pin) FindForChannel(channelUUID string) ([]model.Pin, error) {
+	return m.pinBackend.FindForChannel(channelUUID)
+}
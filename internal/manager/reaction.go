@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"github.com/emilhauk/chitchat/internal/model"
+	"time"
+)
+
+type ReactionBackend interface {
+	Create(reaction model.Reaction) error
+	Delete(reaction model.Reaction) (bool, error)
+	FindForMessages(messageUUIDs ...string) ([]model.Reaction, error)
+}
+
+type Reaction struct {
+	reactionBackend ReactionBackend
+}
+
+func NewReactionManager(reactionBackend ReactionBackend) Reaction {
+	return Reaction{
+		reactionBackend: reactionBackend,
+	}
+}
+
+// Toggle removes the user's reaction with emoji to the message if present, or adds it if not.
+func (m Reaction) Toggle(messageUUID, userUUID, emoji string) error {
+	reaction := model.Reaction{
+		MessageUUID: messageUUID,
+		UserUUID:    userUUID,
+		Emoji:       emoji,
+		CreatedAt:   time.Now(),
+	}
+	removed, err := m.reactionBackend.Delete(reaction)
+	if err != nil || removed {
+		return err
+	}
+	return m.reactionBackend.Create(reaction)
+}
+
+// FindForMessages returns reactions by the UUID of the message reacted to.
+func (m Reaction) FindForMessages(messageUUIDs ...string) (map[string][]model.Reaction, error) {
+	reactionsByMessage := map[string][]model.Reaction{}
+	reactions, err := m.reactionBackend.FindForMessages(messageUUIDs...)
+	if err != nil {
+		return reactionsByMessage, err
+	}
+	for _, reaction := range reactions {
+		reactionsByMessage[reaction.MessageUUID] = append(reactionsByMessage[reaction.MessageUUID], reaction)
+	}
+	return reactionsByMessage, nil
+}
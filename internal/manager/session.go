@@ -10,6 +10,7 @@ type SessionBackend interface {
 	Create(model model.Session) error
 	FindByID(id string) (model.Session, error)
 	SetLastSeenAt(id string, lastSeenAt time.Time) error
+	FindLastSeenForUsers(userUUIDs ...string) (map[string]time.Time, error)
 	Delete(id string) error
 }
 
@@ -58,6 +59,10 @@ func (m Session) SetLastSeenAt(id string, lastSeenAt time.Time) error {
 	return m.sessionBackend.SetLastSeenAt(id, lastSeenAt)
 }
 
+func (m Session) FindLastSeenForUsers(userUUIDs ...string) (map[string]time.Time, error) {
+	return m.sessionBackend.FindLastSeenForUsers(userUUIDs...)
+}
+
 func (m Session) Delete(id string) error {
 	return m.sessionBackend.Delete(id)
 }
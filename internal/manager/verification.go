@@ -1,9 +1,11 @@
 package manager
 
 import (
+	"crypto/subtle"
 	"errors"
 	"github.com/emilhauk/chitchat/config"
 	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/mailer"
 	"github.com/emilhauk/chitchat/internal/model"
 	"github.com/google/uuid"
 	"time"
@@ -12,19 +14,30 @@ import (
 type VerificationBackend interface {
 	Create(verification model.FieldVerification) error
 	FindByUUID(uuid string) (model.FieldVerification, error)
+	Attempt(uuid string, maxAttempts int, notBefore time.Time) (bool, error)
+}
+
+type MailQueue interface {
+	Enqueue(mail model.Mail) (model.Mail, error)
 }
 
 type Verification struct {
 	verificationBackend VerificationBackend
+	mailQueue           MailQueue
 }
 
-func NewVerificationManager(verificationBackend VerificationBackend) Verification {
+func NewVerificationManager(verificationBackend VerificationBackend, mailQueue MailQueue) Verification {
 	return Verification{
 		verificationBackend: verificationBackend,
+		mailQueue:           mailQueue,
 	}
 }
 
+// CreateAndSendCode creates a verification of the field's value, and mails its code to it. Only emails are supported.
 func (m Verification) CreateAndSendCode(userUUID *string, fieldName string, fieldValue string) (model.FieldVerification, error) {
+	if fieldName != "email" {
+		return model.FieldVerification{}, app.ErrUnsupportedValidationField
+	}
 	verification := model.FieldVerification{
 		UUID:       uuid.NewString(),
 		UserUUID:   userUUID,
@@ -43,15 +56,42 @@ func (m Verification) CreateAndSendCode(userUUID *string, fieldName string, fiel
 		return verification, errors.Join(errors.New("failed to create verification"), err)
 	}
 
-	if config.Mail.Enabled {
-		log.Error().Msg("Sending email is not implemented yet :)")
-	} else {
+	if !config.Mail.Enabled {
 		log.Warn().Msg("Email sending disabled. Allowing users to use whatever they like. Should only be used for testing.")
+		return verification, nil
 	}
 
-	return verification, err
+	mail, err := mailer.VerificationCode(fieldValue, code)
+	if err != nil {
+		return verification, errors.Join(errors.New("failed to write verification email"), err)
+	}
+	_, err = m.mailQueue.Enqueue(mail)
+	if err != nil {
+		return verification, errors.Join(errors.New("failed to queue verification email"), err)
+	}
+	return verification, nil
 }
 
 func (m Verification) FindByUUID(uuid string) (model.FieldVerification, error) {
 	return m.verificationBackend.FindByUUID(uuid)
 }
+
+// Verify checks code against the verification's code. The code may be tried model.VerificationMaxAttempts times within
+// model.VerificationTTL of being sent, after which the verification has to be started over.
+func (m Verification) Verify(verification model.FieldVerification, code string) error {
+	if verification.IsExpired() || verification.IsUsedUp() {
+		return app.ErrFieldVerificationExpired
+	}
+	// Counting the attempt before checking the code keeps attempts made at the same time from getting past the limit
+	ok, err := m.verificationBackend.Attempt(verification.UUID, model.VerificationMaxAttempts, time.Now().Add(-model.VerificationTTL))
+	if err != nil {
+		return errors.Join(errors.New("failed to count attempt at verification"), err)
+	}
+	if !ok {
+		return app.ErrFieldVerificationExpired
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(verification.Code)) != 1 {
+		return app.ErrFieldVerificationCodeInvalid
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"errors"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryVerifications is a VerificationBackend keeping verifications in memory, behaving like the field_verifications
+// table.
+type memoryVerifications struct {
+	mu            sync.Mutex
+	verifications map[string]model.FieldVerification
+}
+
+func newMemoryVerifications(verifications ...model.FieldVerification) *memoryVerifications {
+	b := &memoryVerifications{verifications: map[string]model.FieldVerification{}}
+	for _, verification := range verifications {
+		b.verifications[verification.UUID] = verification
+	}
+	return b
+}
+
+func (b *memoryVerifications) Create(verification model.FieldVerification) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.verifications[verification.UUID] = verification
+	return nil
+}
+
+func (b *memoryVerifications) FindByUUID(uuid string) (model.FieldVerification, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	verification, ok := b.verifications[uuid]
+	if !ok {
+		return verification, app.ErrFieldVerificationNotFound
+	}
+	return verification, nil
+}
+
+func (b *memoryVerifications) Attempt(uuid string, maxAttempts int, notBefore time.Time) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	verification, ok := b.verifications[uuid]
+	if !ok || verification.Attempts >= maxAttempts || !verification.CreatedAt.After(notBefore) {
+		return false, nil
+	}
+	verification.Attempts++
+	b.verifications[uuid] = verification
+	return true, nil
+}
+
+func TestVerificationVerify(t *testing.T) {
+	verification := model.FieldVerification{UUID: "verification", Code: "123456", CreatedAt: time.Now()}
+	verifications := NewVerificationManager(newMemoryVerifications(verification), nil)
+
+	if err := verifications.Verify(verification, "654321"); !errors.Is(err, app.ErrFieldVerificationCodeInvalid) {
+		t.Errorf("verifying a wrong code returned %v, want %v", err, app.ErrFieldVerificationCodeInvalid)
+	}
+	if err := verifications.Verify(verification, "12345"); !errors.Is(err, app.ErrFieldVerificationCodeInvalid) {
+		t.Errorf("verifying part of the code returned %v, want %v", err, app.ErrFieldVerificationCodeInvalid)
+	}
+	if err := verifications.Verify(verification, "123456"); err != nil {
+		t.Errorf("verifying the code returned %v, want it verified", err)
+	}
+}
+
+func TestVerificationAllowsFewAttempts(t *testing.T) {
+	verification := model.FieldVerification{UUID: "verification", Code: "123456", CreatedAt: time.Now()}
+	backend := newMemoryVerifications(verification)
+	verifications := NewVerificationManager(backend, nil)
+
+	for attempt := 1; attempt <= model.VerificationMaxAttempts; attempt++ {
+		if err := verifications.Verify(verification, "000000"); !errors.Is(err, app.ErrFieldVerificationCodeInvalid) {
+			t.Fatalf("attempt %d returned %v, want %v", attempt, err, app.ErrFieldVerificationCodeInvalid)
+		}
+	}
+	// The verification may have been loaded before the attempts were made
+	if err := verifications.Verify(verification, "123456"); !errors.Is(err, app.ErrFieldVerificationExpired) {
+		t.Errorf("verifying the code after %d wrong attempts returned %v, want %v", model.VerificationMaxAttempts, err, app.ErrFieldVerificationExpired)
+	}
+	reloaded, _ := backend.FindByUUID(verification.UUID)
+	if err := verifications.Verify(reloaded, "123456"); !errors.Is(err, app.ErrFieldVerificationExpired) {
+		t.Errorf("verifying the code of the used up verification returned %v, want %v", err, app.ErrFieldVerificationExpired)
+	}
+}
+
+func TestVerificationExpires(t *testing.T) {
+	verification := model.FieldVerification{UUID: "verification", Code: "123456", CreatedAt: time.Now().Add(-model.VerificationTTL - time.Second)}
+	verifications := NewVerificationManager(newMemoryVerifications(verification), nil)
+
+	if err := verifications.Verify(verification, "123456"); !errors.Is(err, app.ErrFieldVerificationExpired) {
+		t.Errorf("verifying the code of an expired verification returned %v, want %v", err, app.ErrFieldVerificationExpired)
+	}
+}
@@ -0,0 +1,358 @@
+// Package markdown renders the subset of Markdown messages may be formatted with: bold, italics, inline code, fenced
+// code blocks, links, block quotes and lists. Anything else is text. All text is escaped, and only links to http,
+// https and mailto URLs are made, so the output is safe to put on a page whatever the input.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxDepth limits how deep quotes and emphasis may nest. Anything deeper is left as text.
+const maxDepth = 8
+
+// Segment is a piece of plain text. Class is set when the segment should be presented differently from the rest.
+type Segment struct {
+	Text  string
+	Class string
+}
+
+// Highlighter splits plain text into segments, so parts of it, like mentions, may be presented differently. Code is
+// never highlighted.
+type Highlighter func(text string) []Segment
+
+var (
+	unorderedItem = regexp.MustCompile(`^ {0,3}[-*+][ \t]+(.*)$`)
+	orderedItem   = regexp.MustCompile(`^ {0,3}(\d{1,9})[.)][ \t]+(.*)$`)
+	codeLanguage  = regexp.MustCompile(`^[A-Za-z0-9_+-]{1,32}$`)
+)
+
+// Render returns content as HTML. The highlighter may be nil.
+func Render(content string, highlight Highlighter) template.HTML {
+	r := renderer{highlight: highlight}
+	b := strings.Builder{}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	r.blocks(&b, lines, 0)
+	return template.HTML(b.String())
+}
+
+type renderer struct {
+	highlight Highlighter
+}
+
+func (r renderer) blocks(b *strings.Builder, lines []string, depth int) {
+	for i := 0; i < len(lines); {
+		switch {
+		case strings.TrimSpace(lines[i]) == "":
+			i++
+		case isFence(lines[i]):
+			i = r.codeBlock(b, lines, i)
+		case isQuote(lines[i]) && depth < maxDepth:
+			i = r.quote(b, lines, i, depth)
+		case unorderedItem.MatchString(lines[i]):
+			i = r.list(b, lines, i, unorderedItem, "ul", depth)
+		case orderedItem.MatchString(lines[i]):
+			i = r.list(b, lines, i, orderedItem, "ol", depth)
+		default:
+			i = r.paragraph(b, lines, i, depth)
+		}
+	}
+}
+
+func (r renderer) startsBlock(line string, depth int) bool {
+	return strings.TrimSpace(line) == "" ||
+		isFence(line) ||
+		(isQuote(line) && depth < maxDepth) ||
+		unorderedItem.MatchString(line) ||
+		orderedItem.MatchString(line)
+}
+
+// codeBlock renders the fenced code block starting at line start. A block missing its closing fence runs to the end.
+// It returns the index of the line following the block.
+func (r renderer) codeBlock(b *strings.Builder, lines []string, start int) int {
+	language := strings.TrimPrefix(strings.TrimSpace(lines[start]), "```")
+	end := start + 1
+	for end < len(lines) && strings.TrimSpace(lines[end]) != "```" {
+		end++
+	}
+
+	b.WriteString("<pre><code")
+	if codeLanguage.MatchString(language) {
+		fmt.Fprintf(b, ` class="language-%s"`, language)
+	}
+	b.WriteString(">")
+	// Newlines are written as character references, so that the block survives being sent as a single line of SSE
+	code := html.EscapeString(strings.Join(lines[start+1:min(end, len(lines))], "\n"))
+	b.WriteString(strings.ReplaceAll(code, "\n", "&#10;"))
+	b.WriteString("</code></pre>")
+
+	if end < len(lines) {
+		end++
+	}
+	return end
+}
+
+func (r renderer) quote(b *strings.Builder, lines []string, start int, depth int) int {
+	quoted := make([]string, 0)
+	end := start
+	for end < len(lines) && isQuote(lines[end]) {
+		line := strings.TrimPrefix(strings.TrimLeft(lines[end], " "), ">")
+		quoted = append(quoted, strings.TrimPrefix(line, " "))
+		end++
+	}
+	b.WriteString("<blockquote>")
+	r.blocks(b, quoted, depth+1)
+	b.WriteString("</blockquote>")
+	return end
+}
+
+func (r renderer) list(b *strings.Builder, lines []string, start int, item *regexp.Regexp, tag string, depth int) int {
+	b.WriteString("<" + tag)
+	if tag == "ol" {
+		number, err := strconv.Atoi(item.FindStringSubmatch(lines[start])[1])
+		if err == nil && number != 1 {
+			fmt.Fprintf(b, ` start="%d"`, number)
+		}
+	}
+	b.WriteString(">")
+	end := start
+	for ; end < len(lines); end++ {
+		match := item.FindStringSubmatch(lines[end])
+		if match == nil {
+			break
+		}
+		b.WriteString("<li>")
+		r.inline(b, strings.TrimSpace(match[len(match)-1]), depth, true)
+		b.WriteString("</li>")
+	}
+	b.WriteString("</" + tag + ">")
+	return end
+}
+
+// paragraph renders lines up to the next blank line or block. Line breaks are kept, as is expected in a chat.
+func (r renderer) paragraph(b *strings.Builder, lines []string, start int, depth int) int {
+	b.WriteString("<p>")
+	end := start
+	for ; end < len(lines) && (end == start || !r.startsBlock(lines[end], depth)); end++ {
+		if end > start {
+			b.WriteString("<br>")
+		}
+		r.inline(b, strings.TrimSpace(lines[end]), depth, true)
+	}
+	b.WriteString("</p>")
+	return end
+}
+
+// inline renders text within a block. Links are left as text when allowLinks is unset, as they may not be nested.
+func (r renderer) inline(b *strings.Builder, text string, depth int, allowLinks bool) {
+	plain := strings.Builder{}
+	flush := func() {
+		r.text(b, plain.String())
+		plain.Reset()
+	}
+	// Once the rest of a link can't be found, it won't be found further on either. Remembering so keeps rendering
+	// linear.
+	linksLeft := allowLinks
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && isPunctuation(text[i+1]):
+			plain.WriteByte(text[i+1])
+			i += 2
+			continue
+		case c == '`':
+			if code, end, ok := codeSpan(text, i); ok {
+				flush()
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i = end
+				continue
+			}
+			// The whole run of backticks is text, or its tail would be taken as the start of another span
+			run := backtickRun(text, i)
+			plain.WriteString(text[i : i+run])
+			i += run
+			continue
+		case (c == '*' || c == '_') && depth < maxDepth:
+			if tag, inner, end, ok := emphasis(text, i); ok {
+				flush()
+				b.WriteString("<" + tag + ">")
+				r.inline(b, inner, depth+1, allowLinks)
+				b.WriteString("</" + tag + ">")
+				i = end
+				continue
+			}
+		case c == '[' && linksLeft && depth < maxDepth:
+			label, href, end, found, ok := link(text, i)
+			linksLeft = found
+			if ok {
+				flush()
+				b.WriteString(`<a href="` + html.EscapeString(href) + `" target="_blank" rel="noopener noreferrer nofollow">`)
+				r.inline(b, label, depth+1, false)
+				b.WriteString("</a>")
+				i = end
+				continue
+			}
+		case c == 'h' && allowLinks && (i == 0 || !isWordChar(text[i-1])):
+			if href, end, ok := autolink(text, i); ok {
+				flush()
+				b.WriteString(`<a href="` + html.EscapeString(href) + `" target="_blank" rel="noopener noreferrer nofollow">`)
+				b.WriteString(html.EscapeString(href) + "</a>")
+				i = end
+				continue
+			}
+		}
+		plain.WriteByte(c)
+		i++
+	}
+	flush()
+}
+
+// text writes plain text, escaped and highlighted.
+func (r renderer) text(b *strings.Builder, text string) {
+	if text == "" {
+		return
+	}
+	if r.highlight == nil {
+		b.WriteString(html.EscapeString(text))
+		return
+	}
+	for _, segment := range r.highlight(text) {
+		if segment.Class == "" {
+			b.WriteString(html.EscapeString(segment.Text))
+			continue
+		}
+		b.WriteString(`<span class="` + html.EscapeString(segment.Class) + `">` + html.EscapeString(segment.Text) + "</span>")
+	}
+}
+
+// codeSpan finds the code between the run of backticks at start and the next run of the same length.
+func codeSpan(text string, start int) (code string, end int, ok bool) {
+	run := backtickRun(text, start)
+	fence := strings.Repeat("`", run)
+	closing := strings.Index(text[start+run:], fence)
+	if closing < 0 {
+		return "", 0, false
+	}
+	closing += start + run
+	if backtickRun(text, closing) != run || closing == start+run {
+		return "", 0, false
+	}
+	return text[start+run : closing], closing + run, true
+}
+
+func backtickRun(text string, start int) int {
+	run := 0
+	for start+run < len(text) && text[start+run] == '`' {
+		run++
+	}
+	return run
+}
+
+// emphasis finds text surrounded by * or _ for italics, or ** or __ for bold, starting at start. Underscores within
+// words, like in snake_case, are text.
+func emphasis(text string, start int) (tag, inner string, end int, ok bool) {
+	c := text[start]
+	delimiter, tag := text[start:start+1], "em"
+	if start+1 < len(text) && text[start+1] == c {
+		delimiter, tag = text[start:start+2], "strong"
+	}
+	if c == '_' && start > 0 && isWordChar(text[start-1]) {
+		return "", "", 0, false
+	}
+	innerStart := start + len(delimiter)
+	closing := strings.Index(text[innerStart:], delimiter)
+	if closing <= 0 {
+		return "", "", 0, false
+	}
+	inner = text[innerStart : innerStart+closing]
+	if strings.TrimSpace(inner) != inner {
+		return "", "", 0, false
+	}
+	end = innerStart + closing + len(delimiter)
+	if c == '_' && end < len(text) && isWordChar(text[end]) {
+		return "", "", 0, false
+	}
+	return tag, inner, end, true
+}
+
+// link finds a [label](url) link starting at start. found tells whether a link may still be found further on.
+func link(text string, start int) (label, href string, end int, found, ok bool) {
+	separator := strings.Index(text[start+1:], "](")
+	if separator < 0 {
+		return "", "", 0, false, false
+	}
+	label = text[start+1 : start+1+separator]
+	if label == "" || strings.ContainsAny(label, "[]") {
+		return "", "", 0, true, false
+	}
+	hrefStart := start + 1 + separator + 2
+	closing := strings.IndexByte(text[hrefStart:], ')')
+	if closing < 0 {
+		// Without a closing parenthesis further on, no link can be completed
+		return "", "", 0, false, false
+	}
+	href, ok = safeURL(text[hrefStart : hrefStart+closing])
+	return label, href, hrefStart + closing + 1, true, ok
+}
+
+// autolink finds a bare http or https URL starting at start. Punctuation ending a sentence isn't part of it.
+func autolink(text string, start int) (href string, end int, ok bool) {
+	rest := text[start:]
+	if !strings.HasPrefix(rest, "http://") && !strings.HasPrefix(rest, "https://") {
+		return "", 0, false
+	}
+	end = strings.IndexFunc(rest, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`<>"`+"`", r)
+	})
+	if end < 0 {
+		end = len(rest)
+	}
+	candidate := strings.TrimRight(rest[:end], ".,;:!?'*_)]")
+	href, ok = safeURL(candidate)
+	return href, start + len(candidate), ok
+}
+
+// safeURL tells whether raw is a URL which may be linked to, and returns it trimmed.
+func safeURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.IndexFunc(raw, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return raw, u.Host != ""
+	case "mailto":
+		return raw, u.Opaque != ""
+	default:
+		return "", false
+	}
+}
+
+func isFence(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, "```") && !strings.Contains(trimmed[3:], "`")
+}
+
+func isQuote(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+func isPunctuation(c byte) bool {
+	return c < unicode.MaxASCII && (unicode.IsPunct(rune(c)) || unicode.IsSymbol(rune(c)))
+}
+
+// isWordChar tells whether c is part of a word. Bytes of multibyte characters are taken to be.
+func isWordChar(c byte) bool {
+	return c >= unicode.MaxASCII || c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
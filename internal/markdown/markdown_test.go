@@ -0,0 +1,149 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const linkAttributes = `target="_blank" rel="noopener noreferrer nofollow"`
+
+func TestRenderHostileInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "script tag",
+			content: "<script>alert(1)</script>",
+			want:    "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+		},
+		{
+			name:    "iframe tag",
+			content: `<iframe src="https://evil.example"></iframe>`,
+			want:    `<p>&lt;iframe src=&#34;<a href="https://evil.example" ` + linkAttributes + `>https://evil.example</a>&#34;&gt;&lt;/iframe&gt;</p>`,
+		},
+		{
+			name:    "javascript link",
+			content: "[click](javascript:alert(1))",
+			want:    "<p>[click](javascript:alert(1))</p>",
+		},
+		{
+			name:    "javascript link in mixed case",
+			content: "[click](JavaScript:alert(1))",
+			want:    "<p>[click](JavaScript:alert(1))</p>",
+		},
+		{
+			name:    "data link",
+			content: "[click](data:text/html;base64,PHNjcmlwdD4=)",
+			want:    "<p>[click](data:text/html;base64,PHNjcmlwdD4=)</p>",
+		},
+		{
+			name:    "vbscript link",
+			content: "[click](vbscript:msgbox(1))",
+			want:    "<p>[click](vbscript:msgbox(1))</p>",
+		},
+		{
+			name:    "quotes in link href",
+			content: `[x](https://example.com/"onmouseover="alert(1))`,
+			want:    `<p><a href="https://example.com/&#34;onmouseover=&#34;alert(1" ` + linkAttributes + `>x</a>)</p>`,
+		},
+		{
+			name:    "angle bracket in link href",
+			content: "[x](https://example.com/a>b)",
+			want:    `<p><a href="https://example.com/a&gt;b" ` + linkAttributes + `>x</a></p>`,
+		},
+		{
+			name:    "quote ending autolink",
+			content: `https://example.com/"><script>`,
+			want:    `<p><a href="https://example.com/" ` + linkAttributes + `>https://example.com/</a>&#34;&gt;&lt;script&gt;</p>`,
+		},
+		{
+			name:    "quotes in code fence language",
+			content: "```js\" onclick=\"alert(1)\ncode\n```",
+			want:    "<pre><code>code</code></pre>",
+		},
+		{
+			name:    "angle bracket in code fence language",
+			content: "```a>b\ncode\n```",
+			want:    "<pre><code>code</code></pre>",
+		},
+		{
+			name:    "emphasis within the depth limit",
+			content: "*a __b _c_ b__ a*",
+			want:    "<p><em>a <strong>b <em>c</em> b</strong> a</em></p>",
+		},
+		{
+			name:    "emphasis nested past the depth limit",
+			content: ">>>>>>> *a _b_*",
+			want:    strings.Repeat("<blockquote>", 7) + "<p><em>a _b_</em></p>" + strings.Repeat("</blockquote>", 7),
+		},
+		{
+			name:    "emphasis at the depth limit",
+			content: ">>>>>>>> *deep*",
+			want:    strings.Repeat("<blockquote>", 8) + "<p>*deep*</p>" + strings.Repeat("</blockquote>", 8),
+		},
+		{
+			name:    "quotes nested past the depth limit",
+			content: ">>>>>>>>> text",
+			want:    strings.Repeat("<blockquote>", 8) + "<p>&gt; text</p>" + strings.Repeat("</blockquote>", 8),
+		},
+		{
+			name:    "unclosed code fence",
+			content: "```go\nfmt.Println(\"<b>\")",
+			want:    `<pre><code class="language-go">fmt.Println(&#34;&lt;b&gt;&#34;)</code></pre>`,
+		},
+		{
+			name:    "unclosed backtick",
+			content: "`unclosed <code>",
+			want:    "<p>`unclosed &lt;code&gt;</p>",
+		},
+		{
+			name:    "mismatched backticks",
+			content: "``a`",
+			want:    "<p>``a`</p>",
+		},
+		{
+			name:    "CRLF line endings",
+			content: "line one\r\nline two\r\n\r\n```\r\ncode\r\nmore\r\n```",
+			want:    "<p>line one<br>line two</p><pre><code>code&#10;more</code></pre>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Render(tt.content, nil)); got != tt.want {
+				t.Errorf("Render(%q)\n got: %s\nwant: %s", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderLongInput renders long runs of unfinished or ambiguous syntax. Were rendering quadratic, each would take
+// minutes rather than milliseconds.
+func TestRenderLongInput(t *testing.T) {
+	const repeat = 100_000
+	tests := []struct {
+		name string
+		unit string
+		want string
+	}{
+		{name: "unclosed links", unit: "[a](", want: "<p>" + strings.Repeat("[a](", repeat) + "</p>"},
+		{name: "unclosed emphasis", unit: "*", want: "<p>" + strings.Repeat("*", repeat) + "</p>"},
+		{name: "alternating bold", unit: "**a", want: "<p>" + strings.Repeat("<strong>a</strong>a", repeat/2) + "</p>"},
+		{name: "alternating code", unit: "``a", want: "<p>" + strings.Repeat("<code>a</code>a", repeat/2) + "</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := strings.Repeat(tt.unit, repeat)
+			start := time.Now()
+			got := string(Render(content, nil))
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("rendering %d bytes took %s", len(content), elapsed)
+			}
+			if got != tt.want {
+				t.Errorf("Render(%q x %d) is not as expected. Got %d bytes, want %d", tt.unit, repeat, len(got), len(tt.want))
+			}
+		})
+	}
+}
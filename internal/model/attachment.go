@@ -0,0 +1,69 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ThumbnailContentTypes are the image types thumbnails are made for. They are also the only types shown inline, as
+// they can be trusted not to carry scripts, unlike, say, SVG.
+var ThumbnailContentTypes = []string{"image/png", "image/jpeg", "image/gif"}
+
+type Attachment struct {
+	UUID        string
+	MessageUUID string
+	ChannelUUID string
+	FileName    string
+	// ContentType is detected from the content itself, rather than trusting the uploader
+	ContentType  string
+	Size         int64
+	StorageKey   string
+	ThumbnailKey *string
+	CreatedAt    time.Time
+}
+
+// Upload is a file on its way to become an attachment.
+type Upload struct {
+	FileName string
+	Size     int64
+	Content  io.ReadSeeker
+}
+
+// IsImage tells whether the attachment is an image safe to show inline.
+func (a Attachment) IsImage() bool {
+	for _, contentType := range ThumbnailContentTypes {
+		if a.ContentType == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Attachment) HasThumbnail() bool {
+	return a.ThumbnailKey != nil
+}
+
+func (a Attachment) URL() string {
+	return fmt.Sprintf("/im/channel/%s/attachment/%s", a.ChannelUUID, a.UUID)
+}
+
+func (a Attachment) ThumbnailURL() string {
+	return a.URL() + "/thumbnail"
+}
+
+// HumanSize is the size in the largest unit it amounts to at least one of.
+func (a Attachment) HumanSize() string {
+	units := []string{"B", "KB", "MB", "GB"}
+	size := float64(a.Size)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", a.Size, units[unit])
+	}
+	return strings.Replace(fmt.Sprintf("%.1f %s", size, units[unit]), ".0 ", " ", 1)
+}
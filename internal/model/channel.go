@@ -1,29 +1,336 @@
 package model
 
 import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-type ChannelRole = string
+type ChannelKind = string
 
 const (
-	RoleAdmin ChannelRole = "admin"
+	MaxChannelNameLength        = 50
+	MaxChannelTopicLength       = 255
+	MaxChannelDescriptionLength = 2000
+)
+
+const (
+	// ChannelKindGroup is a named channel anyone may be invited to
+	ChannelKindGroup ChannelKind = "group"
+	// ChannelKindDirect is a conversation between two users, which nobody else may join
+	ChannelKindDirect ChannelKind = "direct"
+)
+
+type ChannelVisibility = string
+
+const (
+	// VisibilityPrivate channels are only reached by invitation
+	VisibilityPrivate ChannelVisibility = "private"
+	// VisibilityPublic channels are listed in the directory, where anyone may join them
+	VisibilityPublic ChannelVisibility = "public"
 )
 
 type Channel struct {
-	UUID               string
-	Name               string
-	Messages           []Message
-	IsCurrentUserAdmin bool
-	InvitationURL      string
-	CreatedAt          time.Time
-	UpdatedAt          *time.Time
+	UUID             string
+	Name             string
+	Topic            string
+	Description      string
+	AvatarKey        *string
+	Kind             ChannelKind
+	Visibility       ChannelVisibility
+	Messages         []Message
+	HasOlderMessages bool
+	HasNewerMessages bool
+	Pins             []Pin
+	Members          []Member
+	CurrentUserRole  ChannelRole
+	UnreadCount      int
+	OnlineCount      int
+	MemberCount      int
+	CreatedAt        time.Time
+	UpdatedAt        *time.Time
+	// ArchivedAt is when the channel was archived, if it is. Archived channels are kept for reading only.
+	ArchivedAt *time.Time
+
+	// CurrentUserNotify is what the current user is notified of in the channel, and until when it is muted
+	CurrentUserNotify     NotifyLevel
+	CurrentUserMutedUntil *time.Time
+	// IsFavourite and SortOrder tell whether the current user has marked the channel as a favourite, and where the user
+	// has placed it in the channel list, if anywhere
+	IsFavourite bool
+	SortOrder   *int
+
+	// DirectUserUUIDs are the two users of a direct channel. Only known when the channel is created.
+	DirectUserUUIDs []string
+	// DirectUser is the other user of a direct channel, as seen by the current user
+	DirectUser *User
+}
+
+func (c Channel) IsDirect() bool {
+	return c.Kind == ChannelKindDirect
+}
+
+// IsMuted tells whether the current user has muted the channel.
+func (c Channel) IsMuted() bool {
+	return c.CurrentUserNotify == NotifyMuted
+}
+
+func (c Channel) IsPublic() bool {
+	return c.Visibility == VisibilityPublic
+}
+
+// IsJoined tells whether the current user is a member of the channel, as far as CurrentUserRole is known.
+func (c Channel) IsJoined() bool {
+	return c.CurrentUserRole != ""
+}
+
+func (c Channel) IsArchived() bool {
+	return c.ArchivedAt != nil
+}
+
+// Allows tells whether the channel, as it is, allows what permission allows to anyone at all. Archived channels only
+// allow what doesn't add to their history.
+func (c Channel) Allows(permission Permission) bool {
+	return !c.IsArchived() || slices.Contains(archivedChannelPermissions, permission)
+}
+
+// IsInvitable tells whether the current user may invite others to the channel. Nobody may be invited to a direct
+// conversation.
+func (c Channel) IsInvitable() bool {
+	return c.currentUserCan(PermissionInvite) && !c.IsDirect()
+}
+
+// IsArchivable tells whether the current user may archive the channel, or bring it back if archived. Direct
+// conversations are never archived.
+func (c Channel) IsArchivable() bool {
+	return c.currentUserCan(PermissionArchive) && !c.IsDirect()
+}
+
+// IsEditable tells whether the current user may change the channel's settings. Direct conversations have none.
+func (c Channel) IsEditable() bool {
+	return c.currentUserCan(PermissionRename) && !c.IsDirect()
+}
+
+// AvatarURL is where the channel's avatar is served from, if it has one. A new avatar gets a new URL, so whatever is
+// served from it never changes.
+func (c Channel) AvatarURL() string {
+	if c.AvatarKey == nil {
+		return ""
+	}
+	return fmt.Sprintf("/im/channel/%s/avatar?v=%s", c.UUID, path.Base(*c.AvatarKey))
+}
+
+// CanPost tells whether the current user may post to the channel.
+func (c Channel) CanPost() bool {
+	return c.currentUserCan(PermissionPost)
+}
+
+// currentUserCan tells whether both the current user's role and the channel allow what permission allows.
+func (c Channel) currentUserCan(permission Permission) bool {
+	return RoleHasPermission(c.CurrentUserRole, permission) && c.Allows(permission)
+}
+
+// DirectKey identifies the direct channel between the users, no matter the order they are given in.
+func DirectKey(userUUIDs ...string) string {
+	sorted := slices.Clone(userUUIDs)
+	slices.Sort(sorted)
+	return strings.Join(sorted, ":")
+}
+
+// LastActiveAt is when the newest message presented was sent, or when the channel was created if none are.
+func (c Channel) LastActiveAt() time.Time {
+	if len(c.Messages) == 0 {
+		return c.CreatedAt
+	}
+	return c.NewestMessage().SentAt
+}
+
+// NewestMessage is the newest of the messages presented.
+func (c Channel) NewestMessage() Message {
+	if len(c.Messages) == 0 {
+		return Message{}
+	}
+	return c.Messages[len(c.Messages)-1]
+}
+
+// ChannelList is the channels of a user, as listed in the menu.
+type ChannelList []Channel
+
+// Favourites are the channels in the list the user has marked as favourites, unless archived.
+func (l ChannelList) Favourites() []Channel {
+	return l.filter(func(channel Channel) bool {
+		return channel.IsFavourite && !channel.IsArchived()
+	})
+}
+
+// Active are the rest of the channels in the list which are not archived.
+func (l ChannelList) Active() []Channel {
+	return l.filter(func(channel Channel) bool {
+		return !channel.IsFavourite && !channel.IsArchived()
+	})
+}
+
+// Archived are the archived channels in the list.
+func (l ChannelList) Archived() []Channel {
+	return l.filter(Channel.IsArchived)
+}
+
+func (l ChannelList) filter(keep func(channel Channel) bool) []Channel {
+	channels := make([]Channel, 0, len(l))
+	for _, channel := range l {
+		if keep(channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
 }
 
+// Sort orders the list the way the user has placed the channels. Channels never placed come after, latest active
+// first. Favourites are listed apart, so their order only matters among themselves.
+func (l ChannelList) Sort() {
+	slices.SortStableFunc(l, func(a, b Channel) int {
+		switch {
+		case a.SortOrder != nil && b.SortOrder != nil && *a.SortOrder != *b.SortOrder:
+			return *a.SortOrder - *b.SortOrder
+		case a.SortOrder != nil && b.SortOrder == nil:
+			return -1
+		case a.SortOrder == nil && b.SortOrder != nil:
+			return 1
+		}
+		if c := b.LastActiveAt().Compare(a.LastActiveAt()); c != 0 {
+			return c
+		}
+		// Channels equally active are kept in the same order every time the list is refreshed
+		return strings.Compare(a.UUID, b.UUID)
+	})
+}
+
+// ChannelSettings are what may be changed about a channel once it is created.
+type ChannelSettings struct {
+	Name        string
+	Topic       string
+	Description string
+	Visibility  ChannelVisibility
+	// Avatar replaces the channel's avatar, if given. Otherwise, RemoveAvatar tells whether to remove it.
+	Avatar       *Upload
+	RemoveAvatar bool
+}
+
+// IsValid tells whether the settings fit the channel.
+func (s ChannelSettings) IsValid() bool {
+	return utf8.RuneCountInString(s.Name) <= MaxChannelNameLength &&
+		utf8.RuneCountInString(s.Topic) <= MaxChannelTopicLength &&
+		utf8.RuneCountInString(s.Description) <= MaxChannelDescriptionLength &&
+		(s.Visibility == VisibilityPrivate || s.Visibility == VisibilityPublic)
+}
+
+type NotifyLevel = string
+
+const (
+	// NotifyAll members are notified of every message in the channel
+	NotifyAll NotifyLevel = "all"
+	// NotifyMentions members are only notified of messages mentioning them
+	NotifyMentions NotifyLevel = "mentions"
+	// NotifyMuted members are notified of nothing, and the channel is played down in their channel list
+	NotifyMuted NotifyLevel = "muted"
+)
+
+// NotifyLevels are all the levels, most notifications first.
+var NotifyLevels = []NotifyLevel{NotifyAll, NotifyMentions, NotifyMuted}
+
 type Member struct {
 	ChannelUUID string
 	UserUUID    string
 	Role        ChannelRole
-	CreatedAt   time.Time
-	UpdatedAt   *time.Time
+	// Notify is what the member is notified of. Muting lasts until MutedUntil, if set.
+	Notify     NotifyLevel
+	MutedUntil *time.Time
+	// IsFavourite and SortOrder are how the member has marked and placed the channel in its channel list
+	IsFavourite bool
+	SortOrder   *int
+	// LastReadMessageUUID is the newest message in the channel history the member has seen, read at LastReadAt
+	LastReadMessageUUID *string
+	LastReadAt          *time.Time
+	CreatedAt           time.Time
+	UpdatedAt           *time.Time
+
+	// User is the member's user, when listing members
+	User User
+	// IsCurrentUser and IsManageable tell whether the member is the current user, and whether the current user may
+	// change the member's role or remove it from the channel. AssignableRoles are the roles the current user may give it.
+	IsCurrentUser   bool
+	IsManageable    bool
+	AssignableRoles []ChannelRole
+}
+
+// NotifyLevelAt is what the member is notified of at the time given. Members whose muting has ended are notified of
+// everything again.
+func (m Member) NotifyLevelAt(t time.Time) NotifyLevel {
+	if m.Notify == NotifyMuted && m.MutedUntil != nil && !t.Before(*m.MutedUntil) {
+		return NotifyAll
+	}
+	if m.Notify == "" {
+		return NotifyAll
+	}
+	return m.Notify
+}
+
+// IsMuted tells whether the member has muted the channel, as of now.
+func (m Member) IsMuted() bool {
+	return m.NotifyLevelAt(time.Now()) == NotifyMuted
+}
+
+// WantsNotification tells whether the member is to be notified of a message, as of now. Whatever notifies members of
+// messages asks here first.
+func (m Member) WantsNotification(mentioned bool) bool {
+	switch m.NotifyLevelAt(time.Now()) {
+	case NotifyMuted:
+		return false
+	case NotifyMentions:
+		return mentioned
+	default:
+		return true
+	}
+}
+
+// IsPrivileged tells whether the member has a role above regular members.
+func (m Member) IsPrivileged() bool {
+	return roleRank(m.Role) > roleRank(RoleMember)
+}
+
+// Can tells whether the member's role is permitted to do what permission allows.
+func (m Member) Can(permission Permission) bool {
+	return RoleHasPermission(m.Role, permission)
+}
+
+// CanManage tells whether the member may change the role of other, or remove it from the channel. Owners may manage
+// anyone, while others who may manage members only manage those with less privileged roles.
+func (m Member) CanManage(other Member) bool {
+	if !m.Can(PermissionManageMembers) || m.UserUUID == other.UserUUID {
+		return false
+	}
+	return m.Role == RoleOwner || roleRank(other.Role) < roleRank(m.Role)
+}
+
+// GrantableRoles are the roles the member may give to others, most privileged first.
+func (m Member) GrantableRoles() []ChannelRole {
+	if !m.Can(PermissionManageMembers) {
+		return nil
+	}
+	roles := make([]ChannelRole, 0, len(ChannelRoles))
+	for _, role := range ChannelRoles {
+		if roleRank(role) <= roleRank(m.Role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// CanDeleteMessage tells whether the member may delete message. Senders may delete their own messages, and those
+// permitted to delete others' messages may delete anyone's.
+func (m Member) CanDeleteMessage(message Message) bool {
+	return message.Sender.UUID == m.UserUUID || m.Can(PermissionDeleteOthersMessages)
 }
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Invitation lets whoever has its code join a channel, until it expires, is used up or is revoked.
+type Invitation struct {
+	Code        string
+	ChannelUUID string
+	CreatedBy   User
+	CreatedAt   time.Time
+	// ExpiresAt and MaxUses are nil for invitations which never expire and may be used any number of times
+	ExpiresAt *time.Time
+	MaxUses   *int
+	Uses      int
+	RevokedAt *time.Time
+	// URL is where the invitation is accepted
+	URL string
+}
+
+func (i Invitation) IsExpired() bool {
+	return i.ExpiresAt != nil && !time.Now().Before(*i.ExpiresAt)
+}
+
+func (i Invitation) IsUsedUp() bool {
+	return i.MaxUses != nil && i.Uses >= *i.MaxUses
+}
+
+func (i Invitation) IsRevoked() bool {
+	return i.RevokedAt != nil
+}
+
+// IsUsable tells whether anyone may still join using the invitation.
+func (i Invitation) IsUsable() bool {
+	return !i.IsExpired() && !i.IsUsedUp() && !i.IsRevoked()
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Mail is an email waiting in the outbox, or one that has been sent from it. Both bodies are the same message, as
+// plain text and as HTML, for the recipient's mail client to choose from.
+type Mail struct {
+	UUID      string
+	Recipient string
+	Subject   string
+	Text      string
+	HTML      string
+	CreatedAt time.Time
+	// Attempts counts the failed attempts at sending the mail, the latest one failing with LastError
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	SentAt        *time.Time
+}
+
+func (m Mail) IsSent() bool {
+	return m.SentAt != nil
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ContentSegment is a piece of message content. Mention is set when the segment mentions a user.
+type ContentSegment struct {
+	Text    string
+	Mention *User
+}
+
+type Mention struct {
+	Message Message
+	Channel Channel
+}
+
+// FindMentions returns the users among candidates who are mentioned in content, by "@" followed by either their
+// name or email.
+func FindMentions(content string, candidates []User) []User {
+	mentioned := make([]User, 0)
+	seen := map[string]bool{}
+	for _, segment := range SplitMentions(content, candidates) {
+		if segment.Mention != nil && !seen[segment.Mention.UUID] {
+			seen[segment.Mention.UUID] = true
+			mentioned = append(mentioned, *segment.Mention)
+		}
+	}
+	return mentioned
+}
+
+// SplitMentions splits content into segments of plain text and mentions of users. Names and emails are matched
+// regardless of case, and the longest match wins, so "@Anna Lee" mentions Anna Lee rather than Anna.
+func SplitMentions(content string, users []User) []ContentSegment {
+	segments := make([]ContentSegment, 0)
+	textStart := 0
+	for i := 0; i < len(content); i++ {
+		if content[i] != '@' || !isMentionBoundaryBefore(content, i) {
+			continue
+		}
+		user, length := matchMention(content[i+1:], users)
+		if user == nil {
+			continue
+		}
+		if textStart < i {
+			segments = append(segments, ContentSegment{Text: content[textStart:i]})
+		}
+		end := i + 1 + length
+		segments = append(segments, ContentSegment{Text: content[i:end], Mention: user})
+		textStart = end
+		i = end - 1
+	}
+	if textStart < len(content) {
+		segments = append(segments, ContentSegment{Text: content[textStart:]})
+	}
+	return segments
+}
+
+func matchMention(rest string, users []User) (*User, int) {
+	var (
+		match       *User
+		matchLength int
+	)
+	for i := range users {
+		for _, candidate := range []string{users[i].Email, users[i].Name} {
+			length := len(candidate)
+			if candidate == "" || length <= matchLength || len(rest) < length {
+				continue
+			}
+			if strings.EqualFold(rest[:length], candidate) && isMentionBoundaryAfter(rest, length) {
+				match = &users[i]
+				matchLength = length
+			}
+		}
+	}
+	return match, matchLength
+}
+
+// isMentionBoundaryBefore makes sure e.g. the "@" in an email address is not taken as a mention.
+func isMentionBoundaryBefore(s string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+func isMentionBoundaryAfter(s string, i int) bool {
+	if i == len(s) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
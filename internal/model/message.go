@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"github.com/emilhauk/chitchat/internal/markdown"
+	"html/template"
+	"time"
+)
 
 type Direction = string
 
@@ -13,10 +17,110 @@ type Message struct {
 	UUID        string
 	ChannelUUID string
 	Sender      User
+	ParentUUID  *string
+	ReplyCount  int
 	Content     string `json:"content"`
+	Mentions    []User
 	Direction   Direction
+	IsDeletable bool
+	IsPinnable  bool
+	IsPinned    bool
+	// IsFocused is set on the message a user jumped to, like from a search result
+	IsFocused bool
+	// MarksRead is set on messages coming in while a user views the channel, which move the user's read marker once seen
+	MarksRead bool
+	Version   uint32
+	SentAt    time.Time
+	DeletedAt *time.Time
+	UpdatedAt *time.Time
+	Versions  []MessageVersion
+	// Reactions are kept as is, so counts can be made for whoever the message is presented to
+	Reactions      []Reaction
+	ReactionCounts []ReactionCount
+	// SeenBy are the other members whose read marker is at this message
+	SeenBy      []User
+	Attachments []Attachment
+}
+
+func (m Message) IsDeleted() bool {
+	return m.DeletedAt != nil
+}
+
+// FormattedContent is the content formatted as HTML from the Markdown subset messages may be written in. Mentions
+// are highlighted.
+func (m Message) FormattedContent() template.HTML {
+	return markdown.Render(m.Content, func(text string) []markdown.Segment {
+		segments := make([]markdown.Segment, 0)
+		for _, segment := range SplitMentions(text, m.Mentions) {
+			formatted := markdown.Segment{Text: segment.Text}
+			if segment.Mention != nil {
+				formatted.Class = "mention"
+			}
+			segments = append(segments, formatted)
+		}
+		return segments
+	})
+}
+
+// AvailableReactions lists the emojis anyone may react to the message with.
+func (m Message) AvailableReactions() []string {
+	return ReactionEmojis
+}
+
+// URL leads to the message where it was sent. Replies are found in their thread, and other messages in the channel
+// history.
+func (m Message) URL() string {
+	if m.IsReply() {
+		return "/im/channel/" + m.ChannelUUID + "/thread/" + *m.ParentUUID
+	}
+	return "/im/channel/" + m.ChannelUUID + "?around=" + m.UUID
+}
+
+func (m Message) IsReply() bool {
+	return m.ParentUUID != nil
+}
+
+// ThreadUUID is the UUID of the message starting the thread this message belongs to. Top level messages start their
+// own thread.
+func (m Message) ThreadUUID() string {
+	if m.ParentUUID != nil {
+		return *m.ParentUUID
+	}
+	return m.UUID
+}
+
+type Thread struct {
+	Channel Channel
+	Parent  Message
+	Replies []Message
+}
+
+// MessagePage is a slice of a channel's history, ordered oldest first. HasOlder and HasNewer tell whether there is
+// more to load in the direction the page was fetched.
+type MessagePage struct {
+	ChannelUUID string
+	Messages    []Message
+	HasOlder    bool
+	HasNewer    bool
+}
+
+func (p MessagePage) Oldest() Message {
+	if len(p.Messages) == 0 {
+		return Message{}
+	}
+	return p.Messages[0]
+}
+
+func (p MessagePage) Newest() Message {
+	if len(p.Messages) == 0 {
+		return Message{}
+	}
+	return p.Messages[len(p.Messages)-1]
+}
+
+type MessageVersion struct {
+	MessageUUID string
 	Version     uint32
-	SentAt      time.Time
-	DeletedAt   *time.Time
-	UpdatedAt   *time.Time
+	Content     string
+	CreatedAt   time.Time
 }
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// Pin keeps a message at hand in the channel's pinned messages.
+type Pin struct {
+	ChannelUUID string
+	MessageUUID string
+	PinnedBy    User
+	PinnedAt    time.Time
+	Message     Message
+}
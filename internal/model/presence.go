@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+type Presence = string
+
+const (
+	PresenceOnline  Presence = "online"
+	PresenceAway    Presence = "away"
+	PresenceOffline Presence = "offline"
+)
+
+// AwayTimeout is how long users are away after they were last seen, before they're offline.
+const AwayTimeout = 5 * time.Minute
+
+// PresenceSince tells the presence of a user who isn't connected, but was last seen at lastSeenAt.
+func PresenceSince(lastSeenAt *time.Time) Presence {
+	if lastSeenAt != nil && time.Since(*lastSeenAt) < AwayTimeout {
+		return PresenceAway
+	}
+	return PresenceOffline
+}
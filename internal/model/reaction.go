@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// ReactionEmojis are the emojis members may react to messages with.
+var ReactionEmojis = []string{"👍", "❤️", "😂", "😮", "😢", "🎉"}
+
+type Reaction struct {
+	MessageUUID string
+	UserUUID    string
+	Emoji       string
+	CreatedAt   time.Time
+}
+
+// ReactionCount sums up how many have reacted to a message with the same emoji.
+type ReactionCount struct {
+	Emoji                  string
+	Count                  int
+	IsReactedByCurrentUser bool
+}
+
+func IsReactionEmoji(emoji string) bool {
+	for _, e := range ReactionEmojis {
+		if e == emoji {
+			return true
+		}
+	}
+	return false
+}
+
+// CountReactions sums up reactions per emoji, in the order each emoji was first used. userUUID is the user the
+// counts are presented to.
+func CountReactions(reactions []Reaction, userUUID string) []ReactionCount {
+	counts := make([]ReactionCount, 0)
+	indexes := map[string]int{}
+	for _, reaction := range reactions {
+		i, ok := indexes[reaction.Emoji]
+		if !ok {
+			i = len(counts)
+			indexes[reaction.Emoji] = i
+			counts = append(counts, ReactionCount{Emoji: reaction.Emoji})
+		}
+		counts[i].Count++
+		if reaction.UserUUID == userUUID {
+			counts[i].IsReactedByCurrentUser = true
+		}
+	}
+	return counts
+}
@@ -0,0 +1,66 @@
+package model
+
+import "slices"
+
+type ChannelRole = string
+
+const (
+	// RoleOwner may do anything in the channel, including making others owners
+	RoleOwner ChannelRole = "owner"
+	// RoleAdmin runs the channel along with its owners, but can't manage them
+	RoleAdmin ChannelRole = "admin"
+	// RoleModerator keeps order in the channel's history
+	RoleModerator ChannelRole = "moderator"
+	// RoleMember is the role of members without any special privileges
+	RoleMember ChannelRole = "member"
+	// RoleReadOnly may read the channel, but not post to it
+	RoleReadOnly ChannelRole = "read-only"
+)
+
+// ChannelRoles are all the roles, most privileged first.
+var ChannelRoles = []ChannelRole{RoleOwner, RoleAdmin, RoleModerator, RoleMember, RoleReadOnly}
+
+type Permission = string
+
+const (
+	PermissionPost                 Permission = "post"
+	PermissionInvite               Permission = "invite"
+	PermissionPin                  Permission = "pin"
+	PermissionDeleteOthersMessages Permission = "delete-others-messages"
+	PermissionRename               Permission = "rename"
+	PermissionManageMembers        Permission = "manage-members"
+	PermissionArchive              Permission = "archive"
+)
+
+// rolePermissions tells what each role is permitted to do. Everyone may read the channel, and unless it's archived,
+// react to its messages and delete their own.
+var rolePermissions = map[ChannelRole][]Permission{
+	RoleOwner:     {PermissionPost, PermissionInvite, PermissionPin, PermissionDeleteOthersMessages, PermissionRename, PermissionManageMembers, PermissionArchive},
+	RoleAdmin:     {PermissionPost, PermissionInvite, PermissionPin, PermissionDeleteOthersMessages, PermissionRename, PermissionManageMembers, PermissionArchive},
+	RoleModerator: {PermissionPost, PermissionInvite, PermissionPin, PermissionDeleteOthersMessages},
+	RoleMember:    {PermissionPost},
+	RoleReadOnly:  {},
+}
+
+// archivedChannelPermissions are what may still be done in an archived channel. Its history may be read, but nothing
+// may be added to it.
+var archivedChannelPermissions = []Permission{PermissionRename, PermissionManageMembers, PermissionArchive}
+
+// IsChannelRole tells whether role is one of ChannelRoles.
+func IsChannelRole(role string) bool {
+	return slices.Contains(ChannelRoles, role)
+}
+
+// RoleHasPermission tells whether role is permitted to do what permission allows.
+func RoleHasPermission(role ChannelRole, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// roleRank orders roles by privilege, higher being more privileged. Unknown roles rank the lowest.
+func roleRank(role ChannelRole) int {
+	i := slices.Index(ChannelRoles, role)
+	if i < 0 {
+		return 0
+	}
+	return len(ChannelRoles) - i
+}
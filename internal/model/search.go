@@ -0,0 +1,144 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MinSearchTermLength is the shortest term the FULLTEXT index knows of
+	MinSearchTermLength = 3
+	maxSearchTerms      = 10
+	// snippetContext is how many characters to show before the first match in a snippet, and snippetLength how many
+	// characters a snippet is at most
+	snippetContext = 60
+	snippetLength  = 240
+)
+
+// SearchQuery is what a user searches their channels for. Filters left empty match everything.
+type SearchQuery struct {
+	Text        string
+	ChannelUUID string
+	SenderUUID  string
+	// From and To are the first and last day messages may be sent
+	From *time.Time
+	To   *time.Time
+}
+
+// Terms are the distinct words of the text searched for, in lower case. Words too short to be indexed are left out.
+func (q SearchQuery) Terms() []string {
+	terms := make([]string, 0)
+	seen := map[string]bool{}
+	words := strings.FieldsFunc(strings.ToLower(q.Text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if seen[word] || len(terms) == maxSearchTerms || utf8.RuneCountInString(word) < MinSearchTermLength {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// BooleanExpression is the search in MySQL's boolean FULLTEXT syntax. Every term long enough to be indexed must be
+// present, either as a word or the beginning of one. The expression is empty if there is nothing to search for.
+func (q SearchQuery) BooleanExpression() string {
+	expression := make([]string, 0)
+	for _, term := range q.Terms() {
+		expression = append(expression, "+"+term+"*")
+	}
+	return strings.Join(expression, " ")
+}
+
+// Until is the moment right after the last day messages may be sent, if limited.
+func (q SearchQuery) Until() *time.Time {
+	if q.To == nil {
+		return nil
+	}
+	until := q.To.AddDate(0, 0, 1)
+	return &until
+}
+
+// FromDate is the first day messages may be sent, formatted as a date input wants it.
+func (q SearchQuery) FromDate() string {
+	return formatDate(q.From)
+}
+
+// ToDate is the last day messages may be sent, formatted as a date input wants it.
+func (q SearchQuery) ToDate() string {
+	return formatDate(q.To)
+}
+
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
+
+type SearchResult struct {
+	Message Message
+	Channel Channel
+	// Snippet is the part of the message around the first match, with the matches marked
+	Snippet []SnippetSegment
+}
+
+type SnippetSegment struct {
+	Text    string
+	IsMatch bool
+}
+
+// MakeSnippet cuts the part of content around the first match of any of the terms, and marks where the terms
+// match.
+func MakeSnippet(content string, terms []string) []SnippetSegment {
+	if len(terms) == 0 {
+		return []SnippetSegment{{Text: truncate(content, snippetLength)}}
+	}
+	quoted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		quoted = append(quoted, regexp.QuoteMeta(term))
+	}
+	pattern := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	start := 0
+	if first := pattern.FindStringIndex(content); first != nil {
+		start = first[0]
+		for i := 0; i < snippetContext && start > 0; i++ {
+			_, size := utf8.DecodeLastRuneInString(content[:start])
+			start -= size
+		}
+	}
+	snippet := truncate(content[start:], snippetLength)
+
+	segments := make([]SnippetSegment, 0)
+	if start > 0 {
+		segments = append(segments, SnippetSegment{Text: "…"})
+	}
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(snippet, -1) {
+		if match[0] > last {
+			segments = append(segments, SnippetSegment{Text: snippet[last:match[0]]})
+		}
+		segments = append(segments, SnippetSegment{Text: snippet[match[0]:match[1]], IsMatch: true})
+		last = match[1]
+	}
+	if last < len(snippet) {
+		segments = append(segments, SnippetSegment{Text: snippet[last:]})
+	}
+	return segments
+}
+
+func truncate(s string, length int) string {
+	for i := range s {
+		if length == 0 {
+			return s[:i] + "…"
+		}
+		length--
+	}
+	return s
+}
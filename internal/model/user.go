@@ -7,6 +7,7 @@ type User struct {
 	Name            string
 	Email           string
 	AvatarUrl       string
+	Presence        Presence
 	EmailVerifiedAt *time.Time
 	CreatedAt       time.Time
 	LastLoginAt     *time.Time
@@ -14,15 +15,31 @@ type User struct {
 	UpdatedAt       *time.Time
 }
 
+const (
+	// VerificationTTL is how long the code of a verification may be used after it was sent
+	VerificationTTL = 15 * time.Minute
+	// VerificationMaxAttempts is how many times the code of a verification may be tried
+	VerificationMaxAttempts = 5
+)
+
 type FieldVerification struct {
 	UUID       string
 	Code       string
 	UserUUID   *string
 	FieldName  string
 	FieldValue string
+	Attempts   int
 	CreatedAt  time.Time
 }
 
+func (v FieldVerification) IsExpired() bool {
+	return !time.Now().Before(v.CreatedAt.Add(VerificationTTL))
+}
+
+func (v FieldVerification) IsUsedUp() bool {
+	return v.Attempts >= VerificationMaxAttempts
+}
+
 type RegisterRequest struct {
 	VerificationUUID string
 	Code             string
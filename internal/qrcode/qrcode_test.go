@@ -0,0 +1,127 @@
+package qrcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestReedSolomonRemainder computes the error correction codewords of published examples: the one in Annex I of ISO/IEC
+// 18004, which is "01234567" in version 1-M, and "HELLO WORLD" in version 1-Q.
+func TestReedSolomonRemainder(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{
+			name: "01234567 1-M",
+			data: []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11},
+			want: []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55},
+		},
+		{
+			name: "HELLO WORLD 1-Q",
+			data: []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236},
+			want: []byte{168, 72, 22, 82, 217, 54, 156, 0, 46, 15, 180, 122, 16},
+		},
+	}
+	for _, test := range tests {
+		got := reedSolomonRemainder(test.data, reedSolomonDivisor(len(test.want)))
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%s: got % X, want % X", test.name, got, test.want)
+		}
+	}
+}
+
+// TestFormatBits expects the format information ISO/IEC 18004 lists for level M with each mask.
+func TestFormatBits(t *testing.T) {
+	want := []int{
+		0b101010000010010,
+		0b101000100100101,
+		0b101111001111100,
+		0b101101101001011,
+		0b100010111111001,
+		0b100000011001110,
+		0b100111110010111,
+		0b100101010100000,
+	}
+	for mask := range want {
+		if got := formatBits(mask); got != want[mask] {
+			t.Errorf("mask %d: got %015b, want %015b", mask, got, want[mask])
+		}
+	}
+}
+
+// TestVersionBits expects the version information ISO/IEC 18004 lists.
+func TestVersionBits(t *testing.T) {
+	want := map[int]int{
+		7:  0x07C94,
+		8:  0x085BC,
+		40: 0x28C69,
+	}
+	for version, bits := range want {
+		if got := versionBits(version); got != bits {
+			t.Errorf("version %d: got %05X, want %05X", version, got, bits)
+		}
+	}
+}
+
+// TestEncode encodes a link to join a channel, and expects the code both rsc.io/qr and github.com/skip2/go-qrcode make
+// of it, which is version 4 with mask 2.
+func TestEncode(t *testing.T) {
+	want := []string{
+		"#######...##.#...#.###.#..#######",
+		"#.....#...######.#..###...#.....#",
+		"#.###.#.#..###..###.##.##.#.###.#",
+		"#.###.#.##..#.#.#..##.....#.###.#",
+		"#.###.#.#..#.#.#..#...#...#.###.#",
+		"#.....#.#..#.####.#.##..#.#.....#",
+		"#######.#.#.#.#.#.#.#.#.#.#######",
+		"........#...#.##..#..#.##........",
+		"#.#####..###.###.#....#.#.#####..",
+		"...###..##..#.#.#.###..#..##.##.#",
+		"....#.#..##.#..##.#.##..##..#.##.",
+		"#.##...######.##.....#....#.###..",
+		"##.##.#..####.....#...#..#..##..#",
+		".###.#..##.##.####..####.......##",
+		"....#.#######......#.#..###...##.",
+		"#.##.#..#.##..#.#.#####..####.#..",
+		"###.#.#....#.##..#.#..#..#.###..#",
+		"..##...##....##.########..##.###.",
+		"...####....#######....#..####.##.",
+		".#####.#..#.###.###..##.#..######",
+		"..#...##.###....#..#.###.#..##.#.",
+		"#..##..###.###.#..#..####.##..#.#",
+		"#.#.#.#.#.#.#.###...###.#..#...#.",
+		"#...#..#######.#...#.#.#.###.##.#",
+		"#..#.####...##.#.##.#..######....",
+		"........###.....#.###...#...#.###",
+		"#######.....#.##..#.##.##.#.#.#..",
+		"#.....#.###...#.....#####...####.",
+		"#.###.#.#.###.#...#.#.#.######...",
+		"#.###.#.#.##.#####.#..#.##..#..##",
+		"#.###.#.#..####..#....#...##.#...",
+		"#.....#...##.##.#..#.#..###.###..",
+		"#######.#.#..##..#.#..####.#.###.",
+	}
+	code, err := Encode("https://chitchat.example/join/q7Xh2kP9vLmN4rT8wYz3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.Size() != len(want) {
+		t.Fatalf("size is %d, want %d", code.Size(), len(want))
+	}
+	for y := range want {
+		row := strings.Builder{}
+		for x := 0; x < code.Size(); x++ {
+			if code.IsDark(x, y) {
+				row.WriteByte('#')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		if row.String() != want[y] {
+			t.Errorf("row %d:\n got: %s\nwant: %s", y, row.String(), want[y])
+		}
+	}
+}
@@ -37,22 +37,72 @@ func NewRouter(authMiddleware internalMiddleware.Auth, sseBroker *sse.Broker) ht
 		r.Use(authMiddleware.RequireAuthenticatedUser)
 		r.Get("/auth/logout", controller.Logout)
 		r.Get("/join/{invitationCode}", controller.Join)
+		r.Get("/join/{invitationCode}/qr-code", controller.GetInvitationQRCode)
 	})
 
 	r.Route("/im", func(r chi.Router) {
 		r.Use(authMiddleware.RequireAuthenticatedUser)
 
 		r.Get("/", controller.Main)
+		r.Get("/mentions", controller.GetMentions)
+		r.Get("/search", controller.Search)
+		r.Route("/directory", func(r chi.Router) {
+			r.Get("/", controller.GetDirectory)
+			r.Post("/{channelUUID}/join", controller.JoinChannel)
+		})
 
 		r.Route("/channel", func(r chi.Router) {
 			r.Get("/stream", sseBroker.ServeHTTPForChannelList)
+			r.Post("/order", controller.OrderChannelList)
 			r.Route("/{channelUUID}", func(r chi.Router) {
 				r.Get("/", controller.GetChannel)
 				r.Get("/stream", sseBroker.ServeHTTPForChannel)
-				r.Post("/message", controller.SendMessage)
+				r.Get("/messages", controller.GetMessages)
+				r.Post("/typing", controller.Typing)
+				r.Post("/leave", controller.LeaveChannel)
+				r.Post("/notify", controller.SetNotifyLevel)
+				r.Post("/favourite", controller.SetFavourite)
+				r.Get("/settings", controller.GetChannelSettings)
+				r.Post("/settings", controller.UpdateChannelSettings)
+				r.Get("/avatar", controller.GetChannelAvatar)
+				r.Post("/archive", controller.ArchiveChannel)
+				r.Post("/unarchive", controller.UnarchiveChannel)
+				r.Route("/members/{userUUID}", func(r chi.Router) {
+					r.Post("/role", controller.SetMemberRole)
+					r.Post("/remove", controller.RemoveMember)
+				})
+				r.Route("/invitations", func(r chi.Router) {
+					r.Get("/", controller.GetInvitations)
+					r.Post("/", controller.CreateInvitation)
+					r.Post("/{invitationCode}/revoke", controller.RevokeInvitation)
+				})
+				r.Route("/attachment/{attachmentUUID}", func(r chi.Router) {
+					r.Get("/", controller.GetAttachment)
+					r.Get("/thumbnail", controller.GetAttachmentThumbnail)
+				})
+				r.Route("/thread/{messageUUID}", func(r chi.Router) {
+					r.Get("/", controller.GetThread)
+					r.Get("/stream", sseBroker.ServeHTTPForThread)
+				})
+				r.Route("/message", func(r chi.Router) {
+					r.Post("/", controller.SendMessage)
+					r.Route("/{messageUUID}", func(r chi.Router) {
+						r.Get("/", controller.GetMessage)
+						r.Post("/", controller.EditMessage)
+						r.Get("/edit", controller.EditMessageForm)
+						r.Post("/delete", controller.DeleteMessage)
+						r.Post("/reaction", controller.ToggleReaction)
+						r.Post("/pin", controller.PinMessage)
+						r.Post("/unpin", controller.UnpinMessage)
+						r.Post("/read", controller.MarkRead)
+						r.Get("/history", controller.GetMessageHistory)
+					})
+				})
 			})
 		})
 
+		r.Post("/direct/{userUUID}", controller.StartDirectConversation)
+
 		r.Route("/new-channel", func(r chi.Router) {
 			r.Get("/", controller.NewChannelForm)
 			r.Post("/", controller.CreateNewChannel)
@@ -1,26 +1,46 @@
 package service
 
 import (
+	app "github.com/emilhauk/chitchat/internal"
 	"github.com/emilhauk/chitchat/internal/manager"
 	"github.com/emilhauk/chitchat/internal/model"
 	"github.com/pkg/errors"
+	"io"
+	"slices"
+	"time"
 )
 
 type Chat struct {
-	userManager    manager.User
-	channelManager manager.Channel
-	messageManager manager.Message
+	userManager       manager.User
+	channelManager    manager.Channel
+	messageManager    manager.Message
+	reactionManager   manager.Reaction
+	mentionManager    manager.Mention
+	attachmentManager manager.Attachment
+	avatarManager     manager.Avatar
+	pinManager        manager.Pin
+	invitationManager manager.Invitation
+	presenceService   Presence
 }
 
-func NewChatService(userManager manager.User, channelManager manager.Channel, messageManager manager.Message) Chat {
+func NewChatService(userManager manager.User, channelManager manager.Channel, messageManager manager.Message, reactionManager manager.Reaction, mentionManager manager.Mention, attachmentManager manager.Attachment, avatarManager manager.Avatar, pinManager manager.Pin, invitationManager manager.Invitation, presenceService Presence) Chat {
 	return Chat{
-		userManager:    userManager,
-		channelManager: channelManager,
-		messageManager: messageManager,
+		userManager:       userManager,
+		channelManager:    channelManager,
+		messageManager:    messageManager,
+		reactionManager:   reactionManager,
+		mentionManager:    mentionManager,
+		attachmentManager: attachmentManager,
+		avatarManager:     avatarManager,
+		pinManager:        pinManager,
+		invitationManager: invitationManager,
+		presenceService:   presenceService,
 	}
 }
 
-func (s Chat) GetChannel(channelUUID string, user model.User) (model.Channel, error) {
+// GetChannel returns the channel with the latest page of its history, or the page around the message with UUID
+// around, if given. The user's read marker is only moved when the latest messages are presented.
+func (s Chat) GetChannel(channelUUID, around string, user model.User) (model.Channel, error) {
 	var channel model.Channel
 	channel, err := s.channelManager.GetChannelForUser(channelUUID, user.UUID)
 	if err != nil {
@@ -30,20 +50,54 @@ func (s Chat) GetChannel(channelUUID string, user model.User) (model.Channel, er
 	if err != nil {
 		return channel, err
 	}
-	channel.IsCurrentUserAdmin = member.Role == model.RoleAdmin
-	messages, err := s.messageManager.FindMessagesForChannel(channelUUID)
+	channel.CurrentUserRole = member.Role
+	presentPreferences(&channel, member)
+	channel, err = s.nameDirectChannel(channel, user)
+	if err != nil {
+		return channel, err
+	}
+	var page model.MessagePage
+	if around != "" {
+		page, err = s.messageManager.FindMessagesAround(channelUUID, around)
+	} else {
+		page, err = s.messageManager.FindMessagesForChannel(channelUUID)
+	}
 	if err != nil {
 		return channel, errors.Wrapf(err, "failed to load messages for channel=%s", channelUUID)
 	}
+	messages := page.Messages
+	for i := range messages {
+		messages[i].IsFocused = messages[i].UUID == around
+	}
 	channel.Messages = messages
-	err = s.enhanceMessages(messages, user)
+	channel.HasOlderMessages = page.HasOlder
+	channel.HasNewerMessages = page.HasNewer
+	channel.Pins, err = s.GetPins(channelUUID, user)
+	if err != nil {
+		return channel, err
+	}
+	channel.Members, err = s.GetMembers(channelUUID, user)
+	if err != nil {
+		return channel, err
+	}
+	err = s.prepareMessages(messages, user, member)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to prepare messages for channel=%s", channelUUID)
+	}
+	err = s.addReadReceipts(channelUUID, messages, user)
 	if err != nil {
-		return channel, errors.Wrapf(err, "failed to enhance messages for channel=%s", channelUUID)
+		return channel, errors.Wrapf(err, "failed to load read receipts for channel=%s", channelUUID)
+	}
+	if len(messages) > 0 && !page.HasNewer {
+		_, err = s.MarkRead(channelUUID, messages[len(messages)-1].UUID, user)
+		if err != nil {
+			return channel, err
+		}
 	}
 	return channel, nil
 }
 
-func (s Chat) GetChannelList(user model.User) ([]model.Channel, error) {
+func (s Chat) GetChannelList(user model.User) (model.ChannelList, error) {
 	channels, err := s.channelManager.GetChannelListForUser(user.UUID)
 	if err != nil {
 		return channels, errors.Wrap(err, "failed to load channel list")
@@ -65,52 +119,1296 @@ func (s Chat) GetChannelList(user model.User) ([]model.Channel, error) {
 	if err != nil {
 		return channels, errors.Wrap(err, "failed to enhance messages for channels")
 	}
+	unreadCounts, err := s.messageManager.CountUnread(user.UUID)
+	if err != nil {
+		return channels, errors.Wrap(err, "failed to count unread messages")
+	}
+	memberships, err := s.channelManager.GetMemberships(user.UUID)
+	if err != nil {
+		return channels, errors.Wrap(err, "failed to load memberships of channels")
+	}
+	// Only who the members are is needed to tell how many of them are online
+	memberUUIDs, err := s.channelManager.GetMemberUUIDsOfChannels(channelUUIDs...)
+	if err != nil {
+		return channels, errors.Wrap(err, "failed to load members of channels")
+	}
+	err = nameDirectChannels(s.userManager, s.channelManager, channels, user)
+	if err != nil {
+		return channels, err
+	}
+	directUserUUIDs := make([]string, 0)
+	for i := range channels {
+		if channels[i].DirectUser != nil {
+			directUserUUIDs = append(directUserUUIDs, channels[i].DirectUser.UUID)
+		}
+	}
+	presences, err := s.presenceService.GetPresences(directUserUUIDs...)
+	if err != nil {
+		return channels, errors.Wrap(err, "failed to load presence of direct contacts")
+	}
+
+	lastMessages := map[string][]model.Message{}
+	for _, m := range messages {
+		lastMessages[m.ChannelUUID] = append(lastMessages[m.ChannelUUID], m)
+	}
 
 	for i := range channels {
-		for _, m := range messages {
-			if channels[i].UUID == m.ChannelUUID {
-				channels[i].Messages = append(channels[i].Messages, m)
+		channels[i].UnreadCount = unreadCounts[channels[i].UUID]
+		if channels[i].DirectUser != nil {
+			channels[i].DirectUser.Presence = presences[channels[i].DirectUser.UUID]
+		}
+		if member, ok := memberships[channels[i].UUID]; ok {
+			presentPreferences(&channels[i], member)
+		}
+		for _, memberUUID := range memberUUIDs[channels[i].UUID] {
+			if memberUUID != user.UUID && s.presenceService.IsOnline(memberUUID) {
+				channels[i].OnlineCount++
 			}
 		}
+		// Muted channels don't ask for attention
+		if channels[i].IsMuted() {
+			channels[i].UnreadCount = 0
+		}
+		channels[i].Messages = append(channels[i].Messages, lastMessages[channels[i].UUID]...)
 	}
+	channels.Sort()
 
 	return channels, nil
 }
 
-func (s Chat) AcceptInvitation(invitationCode, userUUID string) error {
-	channel, err := s.channelManager.FindByUUID(invitationCode)
+// GetMessages returns a page of the channel's history. The page is either right before the message with UUID before,
+// right after the message with UUID after, or the latest page if neither is given.
+func (s Chat) GetMessages(channelUUID string, user model.User, before, after string) (model.MessagePage, error) {
+	page := model.MessagePage{ChannelUUID: channelUUID}
+	_, err := s.channelManager.GetChannelForUser(channelUUID, user.UUID)
 	if err != nil {
-		return err
+		return page, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
 	}
-	user, err := s.userManager.FindByUUID(userUUID)
+	member, err := s.channelManager.GetMemberInfo(channelUUID, user.UUID)
 	if err != nil {
-		return err
+		return page, err
+	}
+	switch {
+	case before != "":
+		page, err = s.messageManager.FindMessagesBefore(channelUUID, before)
+	case after != "":
+		page, err = s.messageManager.FindMessagesAfter(channelUUID, after)
+	default:
+		page, err = s.messageManager.FindMessagesForChannel(channelUUID)
+	}
+	if err != nil {
+		return page, errors.Wrapf(err, "failed to load messages for channel=%s", channelUUID)
+	}
+	err = s.prepareMessages(page.Messages, user, member)
+	if err != nil {
+		return page, errors.Wrapf(err, "failed to prepare messages for channel=%s", channelUUID)
+	}
+	err = s.addReadReceipts(channelUUID, page.Messages, user)
+	if err != nil {
+		return page, errors.Wrapf(err, "failed to load read receipts for channel=%s", channelUUID)
 	}
-	return s.channelManager.AddMember(channel, user, "")
+	return page, nil
 }
 
-func (s Chat) IsMemberOfChannel(channelUUID, userUUID string) (bool, error) {
-	_, err := s.channelManager.GetMemberInfo(channelUUID, userUUID)
+// MarkRead moves the user's read marker in the channel to the message, which the user has now been presented, and
+// tells whether the marker moved. Markers are never moved back to messages older than the one already read.
+func (s Chat) MarkRead(channelUUID, messageUUID string, user model.User) (bool, error) {
+	marked, err := s.channelManager.MarkRead(channelUUID, user.UUID, messageUUID)
 	if err != nil {
-		return false, err
+		return false, errors.Wrapf(err, "failed to mark message=%s as read", messageUUID)
 	}
-	return true, err
+	return marked, nil
 }
 
-func (s Chat) enhanceMessages(messages []model.Message, user model.User) error {
-	userUUIDs := make([]string, 0)
-	for i := range messages {
-		userUUIDs = append(userUUIDs, messages[i].Sender.UUID)
+// SendMessage posts a message to the channel, with the uploads attached. Members of the channel mentioned in the
+// message are recorded in Message.Mentions.
+func (s Chat) SendMessage(channel model.Channel, content string, user model.User, uploads ...model.Upload) (model.Message, error) {
+	message, err := s.send(channel, model.Message{
+		Sender:  user,
+		Content: content,
+	}, uploads)
+	if err != nil {
+		return message, errors.Wrapf(err, "failed to send message to channel=%s", channel.UUID)
+	}
+	return message, nil
+}
+
+// GetMentions returns the latest messages mentioning the user, newest first.
+func (s Chat) GetMentions(user model.User) ([]model.Mention, error) {
+	mentions := make([]model.Mention, 0)
+	messages, err := s.messageManager.FindMentioning(user.UUID)
+	if err != nil {
+		return mentions, errors.Wrap(err, "failed to load messages mentioning user")
+	}
+	err = s.enhanceMessages(messages, user)
+	if err != nil {
+		return mentions, errors.Wrap(err, "failed to enhance messages mentioning user")
+	}
+	channels, err := s.channelManager.GetChannelListForUser(user.UUID)
+	if err != nil {
+		return mentions, errors.Wrap(err, "failed to load channel list")
+	}
+	err = nameDirectChannels(s.userManager, s.channelManager, channels, user)
+	if err != nil {
+		return mentions, err
+	}
+	channelsByUUID := map[string]model.Channel{}
+	for _, channel := range channels {
+		channelsByUUID[channel.UUID] = channel
+	}
+	for _, message := range messages {
+		mentions = append(mentions, model.Mention{
+			Message: message,
+			Channel: channelsByUUID[message.ChannelUUID],
+		})
+	}
+	return mentions, nil
+}
+
+// GetThread returns the message with messageUUID along with all replies to it.
+func (s Chat) GetThread(channelUUID, messageUUID string, user model.User) (model.Thread, error) {
+	var thread model.Thread
+	channel, err := s.channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		return thread, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
+	}
+	thread.Channel, err = s.nameDirectChannel(channel, user)
+	if err != nil {
+		return thread, err
+	}
+	_, parent, member, err := s.getMessageForMember(channelUUID, messageUUID, user)
+	if err != nil {
+		return thread, err
+	}
+	thread.Channel.CurrentUserRole = member.Role
+	if parent.IsReply() {
+		// Threads are only one level deep
+		return thread, app.ErrMessageNotFound
+	}
+	thread.Parent = parent
+	replies, err := s.messageManager.FindReplies(messageUUID)
+	if err != nil {
+		return thread, errors.Wrapf(err, "failed to load replies to message=%s", messageUUID)
+	}
+	err = s.prepareMessages(replies, user, member)
+	if err != nil {
+		return thread, errors.Wrapf(err, "failed to prepare replies to message=%s", messageUUID)
+	}
+	thread.Replies = replies
+	return thread, nil
+}
+
+// PostReply sends a message to the thread started by the message with parentUUID. The parent is returned with its
+// reply count updated.
+func (s Chat) PostReply(channel model.Channel, parentUUID, content string, user model.User, uploads ...model.Upload) (reply model.Message, parent model.Message, err error) {
+	parent, err = s.GetMessage(channel.UUID, parentUUID, user)
+	if err != nil {
+		return reply, parent, err
+	}
+	if parent.IsReply() {
+		return reply, parent, app.ErrMessageNotFound
+	}
+	if parent.IsDeleted() {
+		return reply, parent, app.ErrMessageDeleted
+	}
+	reply, err = s.send(channel, model.Message{
+		Sender:     user,
+		ParentUUID: &parent.UUID,
+		Content:    content,
+	}, uploads)
+	if err != nil {
+		return reply, parent, errors.Wrapf(err, "failed to reply to message=%s", parentUUID)
+	}
+	parent.ReplyCount++
+	return reply, parent, nil
+}
+
+func (s Chat) GetMessage(channelUUID, messageUUID string, user model.User) (model.Message, error) {
+	_, message, _, err := s.getMessageForMember(channelUUID, messageUUID, user)
+	return message, err
+}
+
+// GetMessageToEdit returns the message, if the user may edit it. Only senders may edit their messages, as long as they
+// are still permitted to post to the channel.
+func (s Chat) GetMessageToEdit(channelUUID, messageUUID string, user model.User) (model.Message, error) {
+	_, _, err := s.authorize(channelUUID, user, model.PermissionPost)
+	if err != nil {
+		return model.Message{}, err
+	}
+	message, err := s.GetMessage(channelUUID, messageUUID, user)
+	if err != nil {
+		return message, err
+	}
+	if message.Sender.UUID != user.UUID {
+		return message, app.ErrPermissionDenied
+	}
+	return message, nil
+}
+
+// EditMessage replaces the content of the message. Members mentioned by the new content who weren't mentioned before
+// are returned, as they've not been notified yet.
+func (s Chat) EditMessage(channelUUID, messageUUID, content string, user model.User) (model.Message, []model.User, error) {
+	message, err := s.GetMessageToEdit(channelUUID, messageUUID, user)
+	if err != nil {
+		return message, nil, err
+	}
+	if message.IsDeleted() {
+		return message, nil, app.ErrMessageDeleted
+	}
+	if message.Content == content {
+		return message, nil, nil
+	}
+	message, err = s.messageManager.Edit(message, content)
+	if err != nil {
+		return message, nil, errors.Wrapf(err, "failed to edit message=%s", messageUUID)
+	}
+	members, err := s.getMemberUsers(channelUUID)
+	if err != nil {
+		return message, nil, err
+	}
+	message.Mentions = model.FindMentions(content, members)
+	added, err := s.mentionManager.Replace(message)
+	if err != nil {
+		return message, added, errors.Wrapf(err, "failed to record mentions in message=%s", messageUUID)
+	}
+	return message, added, nil
+}
+
+func (s Chat) DeleteMessage(channelUUID, messageUUID string, user model.User) (model.Message, error) {
+	channel, message, member, err := s.getMessageForMember(channelUUID, messageUUID, user)
+	if err != nil {
+		return message, err
+	}
+	if !member.CanDeleteMessage(message) {
+		return message, app.ErrPermissionDenied
+	}
+	if channel.IsArchived() {
+		return message, app.ErrChannelArchived
+	}
+	if message.IsDeleted() {
+		return message, nil
+	}
+	message, err = s.messageManager.Delete(message)
+	if err != nil {
+		return message, errors.Wrapf(err, "failed to delete message=%s", messageUUID)
+	}
+	if message.IsPinned {
+		_, err = s.pinManager.Unpin(message)
+		if err != nil {
+			return message, errors.Wrapf(err, "failed to unpin deleted message=%s", messageUUID)
+		}
+		message.IsPinned = false
+	}
+	redactDeleted(&message)
+	return message, nil
+}
+
+// GetPins returns the pinned messages of the channel, latest pinned first.
+func (s Chat) GetPins(channelUUID string, user model.User) ([]model.Pin, error) {
+	pins := make([]model.Pin, 0)
+	_, err := s.channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		return pins, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
+	}
+	found, err := s.pinManager.FindForChannel(channelUUID)
+	if err != nil {
+		return pins, errors.Wrapf(err, "failed to load pins of channel=%s", channelUUID)
+	}
+	if len(found) == 0 {
+		return pins, nil
+	}
+	messageUUIDs := make([]string, 0, len(found))
+	userUUIDs := make([]string, 0, len(found))
+	for _, pin := range found {
+		messageUUIDs = append(messageUUIDs, pin.MessageUUID)
+		userUUIDs = append(userUUIDs, pin.PinnedBy.UUID)
+	}
+	byUUID, err := s.messageManager.FindByUUIDs(channelUUID, messageUUIDs...)
+	if err != nil {
+		return pins, errors.Wrapf(err, "failed to load pinned messages of channel=%s", channelUUID)
+	}
+	// Kept in the order of the pins
+	messages := make([]model.Message, 0, len(found))
+	pinned := make([]model.Pin, 0, len(found))
+	for _, pin := range found {
+		if message, ok := byUUID[pin.MessageUUID]; ok {
+			messages = append(messages, message)
+			pinned = append(pinned, pin)
+		}
+	}
+	err = s.enhanceMessages(messages, user)
+	if err != nil {
+		return pins, errors.Wrapf(err, "failed to enhance pinned messages of channel=%s", channelUUID)
 	}
 	users, err := s.userManager.FindAllByUUIDs(userUUIDs...)
+	if err != nil {
+		return pins, errors.Wrapf(err, "failed to load who pinned messages of channel=%s", channelUUID)
+	}
+	for i, pin := range pinned {
+		if messages[i].IsDeleted() {
+			continue
+		}
+		pin.Message = messages[i]
+		pin.PinnedBy = users[pin.PinnedBy.UUID]
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// PinMessage pins the message to the channel, if the user is allowed to. The message is returned along with the
+// channel's pins.
+func (s Chat) PinMessage(channelUUID, messageUUID string, user model.User) (model.Message, []model.Pin, error) {
+	_, _, err := s.authorize(channelUUID, user, model.PermissionPin)
+	if err != nil {
+		return model.Message{}, nil, err
+	}
+	message, err := s.GetMessage(channelUUID, messageUUID, user)
+	if err != nil {
+		return message, nil, err
+	}
+	if message.IsReply() {
+		return message, nil, app.ErrMessageNotFound
+	}
+	if message.IsDeleted() {
+		return message, nil, app.ErrMessageDeleted
+	}
+	err = s.pinManager.Pin(message, user)
+	if err != nil {
+		return message, nil, errors.Wrapf(err, "failed to pin message=%s", messageUUID)
+	}
+	message.IsPinned = true
+	pins, err := s.GetPins(channelUUID, user)
+	return message, pins, err
+}
+
+// UnpinMessage removes the message from the channel's pins, if the user is allowed to. The message is returned along
+// with the channel's pins.
+func (s Chat) UnpinMessage(channelUUID, messageUUID string, user model.User) (model.Message, []model.Pin, error) {
+	_, _, err := s.authorize(channelUUID, user, model.PermissionPin)
+	if err != nil {
+		return model.Message{}, nil, err
+	}
+	message, err := s.GetMessage(channelUUID, messageUUID, user)
+	if err != nil {
+		return message, nil, err
+	}
+	_, err = s.pinManager.Unpin(message)
+	if err != nil {
+		return message, nil, errors.Wrapf(err, "failed to unpin message=%s", messageUUID)
+	}
+	message.IsPinned = false
+	pins, err := s.GetPins(channelUUID, user)
+	return message, pins, err
+}
+
+// ToggleReaction adds the user's reaction with emoji to the message, or removes it if the user already reacted with
+// it. The message is returned with its reactions updated.
+func (s Chat) ToggleReaction(channelUUID, messageUUID, emoji string, user model.User) (model.Message, error) {
+	if !model.IsReactionEmoji(emoji) {
+		return model.Message{}, app.ErrUnsupportedReaction
+	}
+	channel, message, _, err := s.getMessageForMember(channelUUID, messageUUID, user)
+	if err != nil {
+		return message, err
+	}
+	if channel.IsArchived() {
+		return message, app.ErrChannelArchived
+	}
+	if message.IsDeleted() {
+		return message, app.ErrMessageDeleted
+	}
+	err = s.reactionManager.Toggle(messageUUID, user.UUID, emoji)
+	if err != nil {
+		return message, errors.Wrapf(err, "failed to toggle reaction to message=%s", messageUUID)
+	}
+	messages := []model.Message{message}
+	err = s.addReactions(messages, user)
+	if err != nil {
+		return message, errors.Wrapf(err, "failed to load reactions to message=%s", messageUUID)
+	}
+	return messages[0], nil
+}
+
+func (s Chat) GetMessageHistory(channelUUID, messageUUID string, user model.User) (model.Message, error) {
+	message, err := s.GetMessage(channelUUID, messageUUID, user)
+	if err != nil {
+		return message, err
+	}
+	if message.IsDeleted() {
+		return message, nil
+	}
+	message.Versions, err = s.messageManager.FindVersions(messageUUID)
+	if err != nil {
+		return message, errors.Wrapf(err, "failed to load versions of message=%s", messageUUID)
+	}
+	return message, nil
+}
+
+// GetDirectory returns the public channels, which anyone may join, with how many members they have and their latest
+// message. Channels the user is a member of tell the user's role.
+func (s Chat) GetDirectory(user model.User) ([]model.Channel, error) {
+	channels, err := s.channelManager.GetPublicChannels()
+	if err != nil {
+		return channels, errors.Wrap(err, "failed to load public channels")
+	}
+	if len(channels) == 0 {
+		return channels, nil
+	}
+	channelUUIDs := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		channelUUIDs = append(channelUUIDs, channel.UUID)
+	}
+	memberCounts, err := s.channelManager.CountMembersOfChannels(channelUUIDs...)
+	if err != nil {
+		return channels, errors.Wrap(err, "failed to count members of public channels")
+	}
+	memberships, err := s.channelManager.GetMemberships(user.UUID)
+	if err != nil {
+		return channels, errors.Wrap(err, "failed to load memberships of channels")
+	}
+	messages, err := s.messageManager.FindLastMessageForChannels(channelUUIDs...)
+	if err != nil {
+		return channels, errors.Wrap(err, "failed to load last message for public channels")
+	}
+	lastMessages := map[string][]model.Message{}
+	for _, m := range messages {
+		lastMessages[m.ChannelUUID] = append(lastMessages[m.ChannelUUID], m)
+	}
+	for i := range channels {
+		channels[i].MemberCount = memberCounts[channels[i].UUID]
+		if member, ok := memberships[channels[i].UUID]; ok {
+			channels[i].CurrentUserRole = member.Role
+		}
+		channels[i].Messages = append(channels[i].Messages, lastMessages[channels[i].UUID]...)
+	}
+	return channels, nil
+}
+
+// JoinChannel makes the user a member of the public channel. Users who already are members are let through. Channels
+// which aren't public, or are archived, are only reached by invitation.
+func (s Chat) JoinChannel(channelUUID string, user model.User) (model.Channel, error) {
+	channel, err := s.channelManager.FindByUUID(channelUUID)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
+	}
+	isMember, err := s.isMember(channel.UUID, user.UUID)
+	if err != nil || isMember {
+		return channel, err
+	}
+	if !channel.IsPublic() || channel.IsDirect() || channel.IsArchived() {
+		return channel, app.ErrChannelNotFound
+	}
+	err = s.channelManager.AddMember(channel, user, model.RoleMember)
+	if err != nil {
+		// The user may have joined twice at the same time, in which case the first one made it
+		if isMember, _ = s.isMember(channel.UUID, user.UUID); isMember {
+			return channel, nil
+		}
+		return channel, errors.Wrapf(err, "failed to add user=%s to channel=%s", user.UUID, channel.UUID)
+	}
+	return channel, nil
+}
+
+// AcceptInvitation makes the user a member of the channel the invitation is for. Users who already are members are
+// let through without using up the invitation.
+func (s Chat) AcceptInvitation(code string, user model.User) (model.Channel, error) {
+	invitation, err := s.invitationManager.FindByCode(code)
+	if err != nil {
+		return model.Channel{}, err
+	}
+	channel, err := s.channelManager.FindByUUID(invitation.ChannelUUID)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to load channel=%s", invitation.ChannelUUID)
+	}
+	if channel.IsDirect() {
+		// Nobody may join a conversation between two others
+		return channel, app.ErrInvitationNotFound
+	}
+	isMember, err := s.isMember(channel.UUID, user.UUID)
+	if err != nil || isMember {
+		return channel, err
+	}
+	usable, err := s.invitationManager.Use(invitation)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to use invitation to channel=%s", channel.UUID)
+	}
+	if !usable {
+		return channel, app.ErrInvitationNotUsable
+	}
+	err = s.channelManager.AddMember(channel, user, model.RoleMember)
+	if err != nil {
+		// The user may have accepted twice at the same time, in which case the first one made it
+		if isMember, _ = s.isMember(channel.UUID, user.UUID); isMember {
+			return channel, nil
+		}
+		return channel, errors.Wrapf(err, "failed to add user=%s to channel=%s", user.UUID, channel.UUID)
+	}
+	return channel, nil
+}
+
+// GetInvitations returns the invitations to the channel which are not revoked, if the user may invite others to it.
+func (s Chat) GetInvitations(channelUUID string, user model.User) ([]model.Invitation, error) {
+	_, err := s.getChannelToInviteTo(channelUUID, user)
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := s.invitationManager.FindForChannel(channelUUID)
+	if err != nil {
+		return invitations, errors.Wrapf(err, "failed to load invitations to channel=%s", channelUUID)
+	}
+	creators := make(map[string]model.User)
+	for i, invitation := range invitations {
+		creator, found := creators[invitation.CreatedBy.UUID]
+		if !found {
+			creator, err = s.userManager.FindByUUID(invitation.CreatedBy.UUID)
+			if err != nil {
+				return invitations, errors.Wrapf(err, "failed to load user=%s", invitation.CreatedBy.UUID)
+			}
+			creators[creator.UUID] = creator
+		}
+		invitations[i].CreatedBy = creator
+	}
+	return invitations, nil
+}
+
+// GetInvitation returns the invitation, if the user may invite others to the channel it is for.
+func (s Chat) GetInvitation(code string, user model.User) (model.Invitation, error) {
+	invitation, err := s.invitationManager.FindByCode(code)
+	if err != nil {
+		return invitation, err
+	}
+	if invitation.IsRevoked() {
+		return invitation, app.ErrInvitationNotFound
+	}
+	_, err = s.getChannelToInviteTo(invitation.ChannelUUID, user)
+	if errors.Is(err, app.ErrChannelNotFound) || errors.Is(err, app.ErrPermissionDenied) {
+		// Invitations to channels the user can't invite others to are kept secret
+		return invitation, app.ErrInvitationNotFound
+	}
+	return invitation, err
+}
+
+// CreateInvitation makes a new invitation to the channel, if the user may invite others to it. The invitation expires
+// after expiresIn and may be used maxUses times, unless either is zero.
+func (s Chat) CreateInvitation(channelUUID string, expiresIn time.Duration, maxUses int, user model.User) (model.Invitation, error) {
+	channel, err := s.getChannelToInviteTo(channelUUID, user)
+	if err != nil {
+		return model.Invitation{}, err
+	}
+	invitation, err := s.invitationManager.Create(channel, user, expiresIn, maxUses)
+	if err != nil {
+		return invitation, errors.Wrapf(err, "failed to create invitation to channel=%s", channelUUID)
+	}
+	return invitation, nil
+}
+
+// RevokeInvitation stops the invitation to the channel from being used, if the user may invite others to it.
+func (s Chat) RevokeInvitation(channelUUID, code string, user model.User) error {
+	_, err := s.getChannelToInviteTo(channelUUID, user)
 	if err != nil {
 		return err
 	}
-	for i := range messages {
-		messages[i].Sender = users[messages[i].Sender.UUID]
-		messages[i].Direction = model.DirectionIn
-		if messages[i].Sender.UUID == user.UUID {
-			messages[i].Direction = model.DirectionOut
+	revoked, err := s.invitationManager.Revoke(channelUUID, code)
+	if err != nil {
+		return errors.Wrapf(err, "failed to revoke invitation to channel=%s", channelUUID)
+	}
+	if !revoked {
+		return app.ErrInvitationNotFound
+	}
+	return nil
+}
+
+// getChannelToInviteTo returns the channel, as long as the user may invite others to it. Nobody may be invited to a
+// direct conversation.
+func (s Chat) getChannelToInviteTo(channelUUID string, user model.User) (model.Channel, error) {
+	channel, _, err := s.authorize(channelUUID, user, model.PermissionInvite)
+	if err != nil {
+		return channel, err
+	}
+	if channel.IsDirect() {
+		return channel, app.ErrChannelNotFound
+	}
+	return channel, nil
+}
+
+// isMember tells whether the user is a member of the channel.
+func (s Chat) isMember(channelUUID, userUUID string) (bool, error) {
+	_, err := s.channelManager.GetMemberInfo(channelUUID, userUUID)
+	if errors.Is(err, app.ErrMemberNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetMembers returns the members of the channel along with their users, if the user is a member too. They are ordered
+// by role, most privileged first, then by when they joined.
+func (s Chat) GetMembers(channelUUID string, user model.User) ([]model.Member, error) {
+	current, err := s.channelManager.GetMemberInfo(channelUUID, user.UUID)
+	if err != nil {
+		if errors.Is(err, app.ErrMemberNotFound) {
+			return nil, app.ErrChannelNotFound
+		}
+		return nil, errors.Wrapf(err, "failed to load member=%s of channel=%s", user.UUID, channelUUID)
+	}
+	channel, err := s.channelManager.FindByUUID(channelUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
+	}
+	members, err := s.channelManager.GetMembers(channelUUID)
+	if err != nil {
+		return members, errors.Wrapf(err, "failed to load members of channel=%s", channelUUID)
+	}
+	userUUIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		userUUIDs = append(userUUIDs, member.UserUUID)
+	}
+	users, err := s.userManager.FindAllByUUIDs(userUUIDs...)
+	if err != nil {
+		return members, errors.Wrapf(err, "failed to load users in channel=%s", channelUUID)
+	}
+	presences, err := s.presenceService.GetPresences(userUUIDs...)
+	if err != nil {
+		return members, errors.Wrapf(err, "failed to load presence of users in channel=%s", channelUUID)
+	}
+	for i := range members {
+		members[i].User = users[members[i].UserUUID]
+		members[i].User.Presence = presences[members[i].UserUUID]
+		members[i].IsCurrentUser = members[i].UserUUID == user.UUID
+		// Nobody manages the members of a direct conversation
+		members[i].IsManageable = !channel.IsDirect() && current.CanManage(members[i])
+		if members[i].IsManageable {
+			members[i].AssignableRoles = current.GrantableRoles()
+		}
+	}
+	slices.SortStableFunc(members, func(a, b model.Member) int {
+		return slices.Index(model.ChannelRoles, a.Role) - slices.Index(model.ChannelRoles, b.Role)
+	})
+	return members, nil
+}
+
+// LeaveChannel takes the user out of the channel. The last owner must make someone else owner first, unless nobody
+// else is left. Nobody may leave a direct conversation.
+func (s Chat) LeaveChannel(channelUUID string, user model.User) (model.Channel, error) {
+	channel, err := s.channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
+	}
+	if channel.IsDirect() {
+		return channel, app.ErrPermissionDenied
+	}
+	err = s.channelManager.RemoveMember(channelUUID, user.UUID)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to remove user=%s from channel=%s", user.UUID, channelUUID)
+	}
+	return channel, nil
+}
+
+// RemoveMember takes another member out of the channel, if the user may manage that member.
+func (s Chat) RemoveMember(channelUUID, memberUUID string, user model.User) (model.Channel, error) {
+	channel, _, err := s.getMemberToManage(channelUUID, memberUUID, user)
+	if err != nil {
+		return channel, err
+	}
+	err = s.channelManager.RemoveMember(channelUUID, memberUUID)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to remove user=%s from channel=%s", memberUUID, channelUUID)
+	}
+	return channel, nil
+}
+
+// SetMemberRole gives another member a new role, if the user may manage that member and give that role.
+func (s Chat) SetMemberRole(channelUUID, memberUUID string, role model.ChannelRole, user model.User) (model.Channel, error) {
+	if !model.IsChannelRole(role) {
+		return model.Channel{}, app.ErrUnsupportedRole
+	}
+	channel, manager, err := s.getMemberToManage(channelUUID, memberUUID, user)
+	if err != nil {
+		return channel, err
+	}
+	if !slices.Contains(manager.GrantableRoles(), role) {
+		return channel, app.ErrPermissionDenied
+	}
+	err = s.channelManager.SetRole(channelUUID, memberUUID, role)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to set role of user=%s in channel=%s", memberUUID, channelUUID)
+	}
+	return channel, nil
+}
+
+// GetChannelToPostTo returns the channel, as long as the user may post to it, like when telling the others viewing it
+// that the user is typing.
+func (s Chat) GetChannelToPostTo(channelUUID string, user model.User) (model.Channel, error) {
+	channel, _, err := s.authorize(channelUUID, user, model.PermissionPost)
+	return channel, err
+}
+
+// GetChannelToEdit returns the channel, as long as the user may change its settings. Direct conversations have none.
+func (s Chat) GetChannelToEdit(channelUUID string, user model.User) (model.Channel, error) {
+	channel, member, err := s.authorize(channelUUID, user, model.PermissionRename)
+	if err != nil {
+		return channel, err
+	}
+	if channel.IsDirect() {
+		return channel, app.ErrChannelNotFound
+	}
+	channel.CurrentUserRole = member.Role
+	return channel, nil
+}
+
+// UpdateChannel changes the channel's settings, if the user may. A new avatar replaces the old one, which is removed
+// along with its content.
+func (s Chat) UpdateChannel(channelUUID string, settings model.ChannelSettings, user model.User) (model.Channel, error) {
+	channel, err := s.GetChannelToEdit(channelUUID, user)
+	if err != nil {
+		return channel, err
+	}
+	if !settings.IsValid() {
+		return channel, app.ErrChannelSettingsInvalid
+	}
+	oldAvatarKey := channel.AvatarKey
+	channel.Name = settings.Name
+	channel.Topic = settings.Topic
+	channel.Description = settings.Description
+	channel.Visibility = settings.Visibility
+	if settings.Avatar != nil {
+		key, err := s.avatarManager.StoreForChannel(channel, *settings.Avatar)
+		if err != nil {
+			return channel, errors.Wrapf(err, "failed to store avatar of channel=%s", channelUUID)
+		}
+		channel.AvatarKey = &key
+	} else if settings.RemoveAvatar {
+		channel.AvatarKey = nil
+	}
+	channel, err = s.channelManager.Update(channel)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to update channel=%s", channelUUID)
+	}
+	if oldAvatarKey != nil && (channel.AvatarKey == nil || *channel.AvatarKey != *oldAvatarKey) {
+		// The channel no longer refers to it, so failing to remove it only leaves garbage behind
+		if err = s.avatarManager.Delete(*oldAvatarKey); err != nil && !errors.Is(err, app.ErrBlobNotFound) {
+			return channel, errors.Wrapf(err, "failed to remove old avatar of channel=%s", channelUUID)
+		}
+	}
+	return channel, nil
+}
+
+// ArchiveChannel keeps the channel for reading only, if the user may archive it. Its history stays browsable and
+// searchable, but nothing more may be posted to it.
+func (s Chat) ArchiveChannel(channelUUID string, user model.User) (model.Channel, error) {
+	channel, err := s.getChannelToArchive(channelUUID, user)
+	if err != nil || channel.IsArchived() {
+		return channel, err
+	}
+	channel, err = s.channelManager.Archive(channel)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to archive channel=%s", channelUUID)
+	}
+	return channel, nil
+}
+
+// UnarchiveChannel brings the archived channel back into use, if the user may archive it.
+func (s Chat) UnarchiveChannel(channelUUID string, user model.User) (model.Channel, error) {
+	channel, err := s.getChannelToArchive(channelUUID, user)
+	if err != nil || !channel.IsArchived() {
+		return channel, err
+	}
+	channel, err = s.channelManager.Unarchive(channel)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to unarchive channel=%s", channelUUID)
+	}
+	return channel, nil
+}
+
+// getChannelToArchive returns the channel, as long as the user may archive it. Direct conversations are never archived.
+func (s Chat) getChannelToArchive(channelUUID string, user model.User) (model.Channel, error) {
+	channel, _, err := s.authorize(channelUUID, user, model.PermissionArchive)
+	if err != nil {
+		return channel, err
+	}
+	if channel.IsDirect() {
+		return channel, app.ErrChannelNotFound
+	}
+	return channel, nil
+}
+
+// SetNotifyLevel sets what the user is notified of in the channel. Muting lasts until mutedUntil, unless nil, while
+// other levels last until changed.
+func (s Chat) SetNotifyLevel(channelUUID string, notify model.NotifyLevel, mutedUntil *time.Time, user model.User) (model.Channel, error) {
+	if !slices.Contains(model.NotifyLevels, notify) {
+		return model.Channel{}, app.ErrUnsupportedNotifyLevel
+	}
+	if notify != model.NotifyMuted {
+		mutedUntil = nil
+	}
+	channel, err := s.channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
+	}
+	err = s.channelManager.SetNotify(channelUUID, user.UUID, notify, mutedUntil)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to set notification level of user=%s in channel=%s", user.UUID, channelUUID)
+	}
+	channel.CurrentUserNotify = notify
+	channel.CurrentUserMutedUntil = mutedUntil
+	return channel, nil
+}
+
+// SetFavourite marks the channel as one of the user's favourites, or no longer one.
+func (s Chat) SetFavourite(channelUUID string, isFavourite bool, user model.User) (model.Channel, error) {
+	channel, err := s.channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
+	}
+	err = s.channelManager.SetFavourite(channelUUID, user.UUID, isFavourite)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to mark channel=%s as favourite of user=%s", channelUUID, user.UUID)
+	}
+	channel.IsFavourite = isFavourite
+	return channel, nil
+}
+
+// OrderChannelList places the user's channels in the order given. Channels the user isn't a member of are ignored.
+func (s Chat) OrderChannelList(channelUUIDs []string, user model.User) error {
+	err := s.channelManager.SetSortOrder(user.UUID, channelUUIDs)
+	if err != nil {
+		return errors.Wrapf(err, "failed to order channel list of user=%s", user.UUID)
+	}
+	return nil
+}
+
+// GetChannelAvatar returns the content of the channel's avatar, if the user is a member or the channel is public. The
+// caller must close it.
+func (s Chat) GetChannelAvatar(channelUUID string, user model.User) (io.ReadCloser, error) {
+	channel, err := s.channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if errors.Is(err, app.ErrChannelNotFound) {
+		// Public channels are shown in the directory to those who may join them
+		channel, err = s.channelManager.FindByUUID(channelUUID)
+		if err == nil && !channel.IsPublic() {
+			err = app.ErrChannelNotFound
+		}
+	}
+	if err != nil {
+		if errors.Is(err, app.ErrChannelNotFound) {
+			err = app.ErrAvatarNotFound
+		}
+		return nil, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
+	}
+	if channel.AvatarKey == nil {
+		return nil, app.ErrAvatarNotFound
+	}
+	content, err := s.avatarManager.Open(*channel.AvatarKey)
+	if err != nil {
+		if errors.Is(err, app.ErrBlobNotFound) {
+			err = app.ErrAvatarNotFound
+		}
+		return nil, errors.Wrapf(err, "failed to open avatar of channel=%s", channelUUID)
+	}
+	return content, nil
+}
+
+// getMemberToManage returns the channel along with the user's membership, as long as the user may manage the member.
+// Members of direct conversations can't be managed.
+func (s Chat) getMemberToManage(channelUUID, memberUUID string, user model.User) (model.Channel, model.Member, error) {
+	channel, manager, err := s.authorize(channelUUID, user, model.PermissionManageMembers)
+	if err != nil {
+		return channel, manager, err
+	}
+	member, err := s.channelManager.GetMemberInfo(channelUUID, memberUUID)
+	if err != nil {
+		return channel, manager, errors.Wrapf(err, "failed to load member=%s of channel=%s", memberUUID, channelUUID)
+	}
+	if channel.IsDirect() || !manager.CanManage(member) {
+		return channel, manager, app.ErrPermissionDenied
+	}
+	return channel, manager, nil
+}
+
+// authorize returns the channel along with the user's membership, as long as the user's role is permitted to do what
+// permission allows, and the channel allows it too. Whatever depends on the user's role in a channel is checked here.
+func (s Chat) authorize(channelUUID string, user model.User, permission model.Permission) (model.Channel, model.Member, error) {
+	channel, err := s.channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		return channel, model.Member{}, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
+	}
+	member, err := s.channelManager.GetMemberInfo(channelUUID, user.UUID)
+	if err != nil {
+		return channel, member, errors.Wrapf(err, "failed to load member=%s of channel=%s", user.UUID, channelUUID)
+	}
+	if !member.Can(permission) {
+		return channel, member, app.ErrPermissionDenied
+	}
+	if !channel.Allows(permission) {
+		return channel, member, app.ErrChannelArchived
+	}
+	return channel, member, nil
+}
+
+func (s Chat) GetMember(channelUUID, userUUID string) (model.Member, error) {
+	return s.channelManager.GetMemberInfo(channelUUID, userUUID)
+}
+
+// GetAttachment returns the attachment, if the user may see it, along with its content, or the content of its
+// thumbnail. The caller must close the content.
+func (s Chat) GetAttachment(channelUUID, attachmentUUID string, thumbnail bool, user model.User) (model.Attachment, io.ReadCloser, error) {
+	isMember, err := s.IsMemberOfChannel(channelUUID, user.UUID)
+	if err != nil || !isMember {
+		return model.Attachment{}, nil, app.ErrAttachmentNotFound
+	}
+	attachment, err := s.attachmentManager.FindByUUID(attachmentUUID)
+	if err != nil {
+		return attachment, nil, errors.Wrapf(err, "failed to load attachment=%s", attachmentUUID)
+	}
+	// Attachments are only reachable through the channel they were posted in
+	if attachment.ChannelUUID != channelUUID || (thumbnail && !attachment.HasThumbnail()) {
+		return attachment, nil, app.ErrAttachmentNotFound
+	}
+	message, err := s.messageManager.FindByUUID(channelUUID, attachment.MessageUUID)
+	if err != nil {
+		return attachment, nil, errors.Wrapf(err, "failed to load message=%s", attachment.MessageUUID)
+	}
+	if message.IsDeleted() {
+		return attachment, nil, app.ErrAttachmentNotFound
+	}
+	content, err := s.attachmentManager.Open(attachment, thumbnail)
+	if err != nil {
+		if errors.Is(err, app.ErrBlobNotFound) {
+			err = app.ErrAttachmentNotFound
+		}
+		return attachment, nil, errors.Wrapf(err, "failed to open attachment=%s", attachmentUUID)
+	}
+	return attachment, content, nil
+}
+
+// StartDirectConversation returns the direct channel between the user and the other user, which is created if they
+// have none yet. Users may only start conversations with those they already share a channel with.
+func (s Chat) StartDirectConversation(otherUUID string, user model.User) (model.Channel, error) {
+	if otherUUID == user.UUID {
+		return model.Channel{}, app.ErrUserNotFound
+	}
+	contacts, err := s.channelManager.GetContacts(user.UUID)
+	if err != nil {
+		return model.Channel{}, errors.Wrap(err, "failed to load contacts")
+	}
+	if !slices.Contains(contacts, otherUUID) {
+		return model.Channel{}, app.ErrUserNotFound
+	}
+	other, err := s.userManager.FindByUUID(otherUUID)
+	if err != nil {
+		return model.Channel{}, errors.Wrapf(err, "failed to load user=%s", otherUUID)
+	}
+	channel, err := s.channelManager.GetOrCreateDirect(user, other)
+	if err != nil {
+		return channel, errors.Wrapf(err, "failed to start direct conversation with user=%s", otherUUID)
+	}
+	return channel, nil
+}
+
+func (s Chat) IsMemberOfChannel(channelUUID, userUUID string) (bool, error) {
+	_, err := s.channelManager.GetMemberInfo(channelUUID, userUUID)
+	if err != nil {
+		return false, err
+	}
+	return true, err
+}
+
+func (s Chat) send(channel model.Channel, message model.Message, uploads []model.Upload) (model.Message, error) {
+	_, _, err := s.authorize(channel.UUID, message.Sender, model.PermissionPost)
+	if err != nil {
+		return message, err
+	}
+	members, err := s.getMemberUsers(channel.UUID)
+	if err != nil {
+		return message, err
+	}
+	message.Mentions = model.FindMentions(message.Content, members)
+	message.Attachments, err = s.attachmentManager.Store(channel.UUID, uploads...)
+	if err != nil {
+		return message, errors.Wrapf(err, "failed to store attachments in channel=%s", channel.UUID)
+	}
+	// The message is stored along with its mentions and attachments, or not at all
+	message, err = s.messageManager.Send(channel, message)
+	if err != nil {
+		// Nothing refers to the attachments, so failing to remove them only leaves garbage behind
+		_ = s.attachmentManager.Discard(message.Attachments...)
+		return message, errors.Wrapf(err, "failed to send message to channel=%s", channel.UUID)
+	}
+	return message, nil
+}
+
+// nameDirectChannel names the channel after the other user, if it is a direct channel.
+func (s Chat) nameDirectChannel(channel model.Channel, user model.User) (model.Channel, error) {
+	channels := []model.Channel{channel}
+	err := nameDirectChannels(s.userManager, s.channelManager, channels, user)
+	return channels[0], err
+}
+
+// getMemberUsers returns the users who are members of the channel.
+func (s Chat) getMemberUsers(channelUUID string) ([]model.User, error) {
+	members, err := s.channelManager.GetMembers(channelUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load members of channel=%s", channelUUID)
+	}
+	userUUIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		userUUIDs = append(userUUIDs, member.UserUUID)
+	}
+	usersByUUID, err := s.userManager.FindAllByUUIDs(userUUIDs...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load users in channel=%s", channelUUID)
+	}
+	users := make([]model.User, 0, len(usersByUUID))
+	for _, userUUID := range userUUIDs {
+		if user, ok := usersByUUID[userUUID]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s Chat) getMessageForMember(channelUUID, messageUUID string, user model.User) (model.Channel, model.Message, model.Member, error) {
+	var message model.Message
+	channel, err := s.channelManager.GetChannelForUser(channelUUID, user.UUID)
+	if err != nil {
+		return channel, message, model.Member{}, errors.Wrapf(err, "failed to load channel=%s", channelUUID)
+	}
+	member, err := s.channelManager.GetMemberInfo(channelUUID, user.UUID)
+	if err != nil {
+		return channel, message, member, err
+	}
+	message, err = s.messageManager.FindByUUID(channelUUID, messageUUID)
+	if err != nil {
+		return channel, message, member, errors.Wrapf(err, "failed to load message=%s", messageUUID)
+	}
+	messages := []model.Message{message}
+	err = s.prepareMessages(messages, user, member)
+	if err != nil {
+		return channel, message, member, errors.Wrapf(err, "failed to prepare message=%s", messageUUID)
+	}
+	return channel, messages[0], member, nil
+}
+
+// prepareMessages fills in everything needed to present messages to the member.
+func (s Chat) prepareMessages(messages []model.Message, user model.User, member model.Member) error {
+	err := s.enhanceMessages(messages, user)
+	if err != nil {
+		return err
+	}
+	markDeletable(messages, member)
+	err = s.markPinned(messages, member)
+	if err != nil {
+		return errors.Wrap(err, "failed to load pins")
+	}
+	err = s.countReplies(messages)
+	if err != nil {
+		return errors.Wrap(err, "failed to count replies")
+	}
+	err = s.addReactions(messages, user)
+	if err != nil {
+		return errors.Wrap(err, "failed to load reactions")
+	}
+	return nil
+}
+
+func (s Chat) enhanceMessages(messages []model.Message, user model.User) error {
+	messageUUIDs := make([]string, 0)
+	userUUIDs := make([]string, 0)
+	for i := range messages {
+		messageUUIDs = append(messageUUIDs, messages[i].UUID)
+		userUUIDs = append(userUUIDs, messages[i].Sender.UUID)
+	}
+	mentions, err := s.mentionManager.FindForMessages(messageUUIDs...)
+	if err != nil {
+		return err
+	}
+	for _, mentioned := range mentions {
+		userUUIDs = append(userUUIDs, mentioned...)
+	}
+	attachments, err := s.attachmentManager.FindForMessages(messageUUIDs...)
+	if err != nil {
+		return err
+	}
+	users, err := s.userManager.FindAllByUUIDs(userUUIDs...)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Sender = users[messages[i].Sender.UUID]
+		messages[i].Mentions = nil
+		for _, userUUID := range mentions[messages[i].UUID] {
+			messages[i].Mentions = append(messages[i].Mentions, users[userUUID])
+		}
+		messages[i].Attachments = attachments[messages[i].UUID]
+		messages[i].Direction = model.DirectionIn
+		if messages[i].Sender.UUID == user.UUID {
+			messages[i].Direction = model.DirectionOut
+		}
+		redactDeleted(&messages[i])
+	}
+	return nil
+}
+
+func (s Chat) countReplies(messages []model.Message) error {
+	parentUUIDs := make([]string, 0)
+	for i := range messages {
+		if !messages[i].IsReply() {
+			parentUUIDs = append(parentUUIDs, messages[i].UUID)
+		}
+	}
+	counts, err := s.messageManager.CountReplies(parentUUIDs...)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].ReplyCount = counts[messages[i].UUID]
+	}
+	return nil
+}
+
+func (s Chat) addReactions(messages []model.Message, user model.User) error {
+	messageUUIDs := make([]string, 0)
+	for i := range messages {
+		messageUUIDs = append(messageUUIDs, messages[i].UUID)
+	}
+	reactions, err := s.reactionManager.FindForMessages(messageUUIDs...)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		if messages[i].IsDeleted() {
+			continue
+		}
+		messages[i].Reactions = reactions[messages[i].UUID]
+		messages[i].ReactionCounts = model.CountReactions(messages[i].Reactions, user.UUID)
+	}
+	return nil
+}
+
+// addReadReceipts tells which of the messages other members of the channel have read up to.
+func (s Chat) addReadReceipts(channelUUID string, messages []model.Message, user model.User) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	members, err := s.channelManager.GetMembers(channelUUID)
+	if err != nil {
+		return err
+	}
+	messageIndexes := map[string]int{}
+	for i := range messages {
+		messageIndexes[messages[i].UUID] = i
+	}
+	readers := map[string]string{}
+	userUUIDs := make([]string, 0)
+	for _, member := range members {
+		if member.UserUUID == user.UUID || member.LastReadMessageUUID == nil {
+			continue
+		}
+		if _, ok := messageIndexes[*member.LastReadMessageUUID]; ok {
+			readers[member.UserUUID] = *member.LastReadMessageUUID
+			userUUIDs = append(userUUIDs, member.UserUUID)
+		}
+	}
+	if len(userUUIDs) == 0 {
+		return nil
+	}
+	users, err := s.userManager.FindAllByUUIDs(userUUIDs...)
+	if err != nil {
+		return err
+	}
+	for _, userUUID := range userUUIDs {
+		i := messageIndexes[readers[userUUID]]
+		messages[i].SeenBy = append(messages[i].SeenBy, users[userUUID])
+	}
+	return nil
+}
+
+// presentPreferences tells the channel how its current user, the member, wants it presented: what the user is notified
+// of as of now, and how the user has marked and placed it.
+func presentPreferences(channel *model.Channel, member model.Member) {
+	channel.CurrentUserNotify = member.NotifyLevelAt(time.Now())
+	if channel.CurrentUserNotify == model.NotifyMuted {
+		channel.CurrentUserMutedUntil = member.MutedUntil
+	}
+	channel.IsFavourite = member.IsFavourite
+	channel.SortOrder = member.SortOrder
+}
+
+func markDeletable(messages []model.Message, member model.Member) {
+	for i := range messages {
+		messages[i].IsDeletable = !messages[i].IsDeleted() && member.CanDeleteMessage(messages[i])
+	}
+}
+
+// markPinned tells which of the messages are pinned, and whether the member may pin or unpin them. The messages are
+// all from the same channel.
+func (s Chat) markPinned(messages []model.Message, member model.Member) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	pins, err := s.pinManager.FindForChannel(messages[0].ChannelUUID)
+	if err != nil {
+		return err
+	}
+	pinned := map[string]bool{}
+	for _, pin := range pins {
+		pinned[pin.MessageUUID] = true
+	}
+	for i := range messages {
+		messages[i].IsPinned = pinned[messages[i].UUID]
+		// Only the channel history may be pinned, not replies in threads
+		messages[i].IsPinnable = !messages[i].IsDeleted() && !messages[i].IsReply() && member.Can(model.PermissionPin)
+	}
+	return nil
+}
+
+// redactDeleted makes sure nothing of a deleted message's content leaves the service.
+func redactDeleted(message *model.Message) {
+	if message.IsDeleted() {
+		message.Content = ""
+		message.Versions = nil
+		message.Attachments = nil
+	}
+}
+
+// nameDirectChannels names the direct channels among channels after the other user of each. Direct channels have no
+// name of their own, so each of the two users sees it named after the other.
+func nameDirectChannels(userManager manager.User, channelManager manager.Channel, channels []model.Channel, user model.User) error {
+	channelUUIDs := make([]string, 0)
+	for i := range channels {
+		if channels[i].IsDirect() {
+			channelUUIDs = append(channelUUIDs, channels[i].UUID)
+		}
+	}
+	if len(channelUUIDs) == 0 {
+		return nil
+	}
+	memberUUIDs, err := channelManager.GetMemberUUIDsOfChannels(channelUUIDs...)
+	if err != nil {
+		return errors.Wrap(err, "failed to load members of direct channels")
+	}
+	others := map[string]string{}
+	userUUIDs := make([]string, 0)
+	for i := range channels {
+		if !channels[i].IsDirect() {
+			continue
+		}
+		for _, memberUUID := range memberUUIDs[channels[i].UUID] {
+			if memberUUID != user.UUID {
+				others[channels[i].UUID] = memberUUID
+				userUUIDs = append(userUUIDs, memberUUID)
+			}
+		}
+	}
+	if len(userUUIDs) == 0 {
+		return nil
+	}
+	users, err := userManager.FindAllByUUIDs(userUUIDs...)
+	if err != nil {
+		return errors.Wrap(err, "failed to load users of direct channels")
+	}
+	for i := range channels {
+		if other, ok := users[others[channels[i].UUID]]; ok {
+			channels[i].Name = other.Name
+			channels[i].DirectUser = &other
 		}
 	}
 	return nil
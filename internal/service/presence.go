@@ -0,0 +1,118 @@
+package service
+
+import (
+	"github.com/emilhauk/chitchat/internal/manager"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// Presence tells whether users are online, away or offline. Users are online while connected to the channel list
+// stream, and away for a while after they were last seen, either through a request or by disconnecting.
+type Presence struct {
+	sessionManager manager.Session
+	channelManager manager.Channel
+
+	mtx            *sync.Mutex
+	connections    map[string]int
+	disconnectedAt map[string]time.Time
+}
+
+func NewPresenceService(sessionManager manager.Session, channelManager manager.Channel) Presence {
+	return Presence{
+		sessionManager: sessionManager,
+		channelManager: channelManager,
+		mtx:            new(sync.Mutex),
+		connections:    make(map[string]int),
+		disconnectedAt: make(map[string]time.Time),
+	}
+}
+
+// Connect registers a new connection for the user. It tells whether the user just came online.
+func (s Presence) Connect(userUUID string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.connections[userUUID]++
+	delete(s.disconnectedAt, userUUID)
+	return s.connections[userUUID] == 1
+}
+
+// Disconnect unregisters a connection for the user. It tells whether the user just went away.
+func (s Presence) Disconnect(userUUID string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.connections[userUUID] == 0 {
+		return false
+	}
+	s.connections[userUUID]--
+	if s.connections[userUUID] > 0 {
+		return false
+	}
+	delete(s.connections, userUUID)
+	s.disconnectedAt[userUUID] = time.Now()
+	return true
+}
+
+// GoOffline tells whether the user is offline, having been away for model.AwayTimeout since disconnecting. When offline,
+// the time of disconnecting is forgotten, and the user goes by when last seen from then on.
+func (s Presence) GoOffline(userUUID string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	disconnectedAt, ok := s.disconnectedAt[userUUID]
+	if !ok || s.connections[userUUID] > 0 || time.Since(disconnectedAt) < model.AwayTimeout {
+		return false
+	}
+	delete(s.disconnectedAt, userUUID)
+	return true
+}
+
+func (s Presence) IsOnline(userUUID string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.connections[userUUID] > 0
+}
+
+// GetPresences returns the presence of each of the users, by user UUID.
+func (s Presence) GetPresences(userUUIDs ...string) (map[string]model.Presence, error) {
+	presences := map[string]model.Presence{}
+	absent := make([]string, 0)
+	for _, userUUID := range userUUIDs {
+		if s.IsOnline(userUUID) {
+			presences[userUUID] = model.PresenceOnline
+		} else {
+			absent = append(absent, userUUID)
+		}
+	}
+	lastSeen, err := s.sessionManager.FindLastSeenForUsers(absent...)
+	if err != nil {
+		return presences, errors.Wrap(err, "failed to load when users were last seen")
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, userUUID := range absent {
+		var lastSeenAt *time.Time
+		if seenAt, ok := lastSeen[userUUID]; ok {
+			lastSeenAt = &seenAt
+		}
+		if disconnectedAt, ok := s.disconnectedAt[userUUID]; ok && (lastSeenAt == nil || disconnectedAt.After(*lastSeenAt)) {
+			lastSeenAt = &disconnectedAt
+		}
+		presences[userUUID] = model.PresenceSince(lastSeenAt)
+	}
+	return presences, nil
+}
+
+// GetContacts returns the UUIDs of the users who should learn about the user's presence.
+func (s Presence) GetContacts(userUUID string) ([]string, error) {
+	contacts, err := s.channelManager.GetContacts(userUUID)
+	if err != nil {
+		return contacts, errors.Wrapf(err, "failed to load contacts of user=%s", userUUID)
+	}
+	return contacts, nil
+}
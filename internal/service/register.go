@@ -15,6 +15,7 @@ var log = config.Logger
 type VerificationManager interface {
 	CreateAndSendCode(userUUID *string, fieldName string, fieldValue string) (model.FieldVerification, error)
 	FindByUUID(uuid string) (model.FieldVerification, error)
+	Verify(verification model.FieldVerification, code string) error
 }
 
 type UserManager interface {
@@ -58,13 +59,13 @@ func (s Register) Fulfill(registerRequest model.RegisterRequest) (user model.Use
 		return user, err
 	}
 	var emailVerifiedAt *time.Time
-	if verification.Code == registerRequest.Code {
-		now := time.Now()
-		emailVerifiedAt = &now
-	} else if registerRequest.Code == "" && !config.Mail.Enabled {
+	if registerRequest.Code == "" && !config.Mail.Enabled {
 		log.Warn().Msg("Verification disabled. Allowing unverified email through.")
+	} else if err = s.verificationManager.Verify(verification, registerRequest.Code); err != nil {
+		return user, err
 	} else {
-		return user, app.ErrFieldVerificationCodeInvalid
+		now := time.Now()
+		emailVerifiedAt = &now
 	}
 
 	user = model.User{
@@ -0,0 +1,112 @@
+package service
+
+import (
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/manager"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// Search finds messages in the channels a user is a member of.
+type Search struct {
+	userManager    manager.User
+	channelManager manager.Channel
+	messageManager manager.Message
+}
+
+func NewSearchService(userManager manager.User, channelManager manager.Channel, messageManager manager.Message) Search {
+	return Search{
+		userManager:    userManager,
+		channelManager: channelManager,
+		messageManager: messageManager,
+	}
+}
+
+// SearchResults are the newest matches of a search. HasMore tells whether older matches were left out.
+type SearchResults struct {
+	Query   model.SearchQuery
+	Results []model.SearchResult
+	HasMore bool
+}
+
+// SearchMessages returns the newest messages matching the query, which the user may see. app.ErrSearchTooShort is
+// returned if the query has no term long enough to search for.
+func (s Search) SearchMessages(query model.SearchQuery, user model.User) (SearchResults, error) {
+	results := SearchResults{Query: query, Results: make([]model.SearchResult, 0)}
+	if query.BooleanExpression() == "" {
+		return results, app.ErrSearchTooShort
+	}
+	messages, hasMore, err := s.messageManager.Search(user.UUID, query)
+	if err != nil {
+		return results, errors.Wrap(err, "failed to search messages")
+	}
+	results.HasMore = hasMore
+	if len(messages) == 0 {
+		return results, nil
+	}
+
+	channels, err := s.GetChannels(user)
+	if err != nil {
+		return results, err
+	}
+	channelsByUUID := map[string]model.Channel{}
+	for _, channel := range channels {
+		channelsByUUID[channel.UUID] = channel
+	}
+	userUUIDs := make([]string, 0, len(messages))
+	for _, message := range messages {
+		userUUIDs = append(userUUIDs, message.Sender.UUID)
+	}
+	users, err := s.userManager.FindAllByUUIDs(userUUIDs...)
+	if err != nil {
+		return results, errors.Wrap(err, "failed to load senders of messages found")
+	}
+
+	terms := query.Terms()
+	for _, message := range messages {
+		message.Sender = users[message.Sender.UUID]
+		message.Direction = model.DirectionIn
+		if message.Sender.UUID == user.UUID {
+			message.Direction = model.DirectionOut
+		}
+		results.Results = append(results.Results, model.SearchResult{
+			Message: message,
+			Channel: channelsByUUID[message.ChannelUUID],
+			Snippet: model.MakeSnippet(message.Content, terms),
+		})
+	}
+	return results, nil
+}
+
+// GetChannels returns the channels the user may search, to filter by.
+func (s Search) GetChannels(user model.User) ([]model.Channel, error) {
+	channels, err := s.channelManager.GetChannelListForUser(user.UUID)
+	if err != nil {
+		return channels, errors.Wrap(err, "failed to load channel list")
+	}
+	err = nameDirectChannels(s.userManager, s.channelManager, channels, user)
+	return channels, err
+}
+
+// GetSenders returns the users who may have sent messages the user can find, to filter by.
+func (s Search) GetSenders(user model.User) ([]model.User, error) {
+	senders := make([]model.User, 0)
+	userUUIDs, err := s.channelManager.GetContacts(user.UUID)
+	if err != nil {
+		return senders, errors.Wrap(err, "failed to load contacts")
+	}
+	users, err := s.userManager.FindAllByUUIDs(userUUIDs...)
+	if err != nil {
+		return senders, errors.Wrap(err, "failed to load contacts")
+	}
+	for _, userUUID := range userUUIDs {
+		if u, ok := users[userUUID]; ok {
+			senders = append(senders, u)
+		}
+	}
+	sort.Slice(senders, func(i, j int) bool {
+		return senders[i].Name < senders[j].Name
+	})
+	return senders, nil
+}
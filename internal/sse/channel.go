@@ -13,21 +13,99 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
 )
 
 type ChatService interface {
-	IsMemberOfChannel(channelUUID, userUUID string) (bool, error)
-	GetChannelList(user model.User) ([]model.Channel, error)
+	GetMember(channelUUID, userUUID string) (model.Member, error)
+	GetMessage(channelUUID, messageUUID string, user model.User) (model.Message, error)
+	GetChannelList(user model.User) (model.ChannelList, error)
 }
 
+const (
+	EventMessage  = "message"
+	EventEdited   = "edited"
+	EventDeleted  = "deleted"
+	EventReplies  = "replies"
+	EventReaction = "reaction"
+	EventMention  = "mention"
+	EventRead     = "read"
+	EventReceipt  = "receipt"
+	EventTyping   = "typing"
+	EventPresence = "presence"
+	EventPin      = "pin"
+	EventRemoved  = "removed"
+	EventRole     = "role"
+	EventSettings = "settings"
+	EventNotify   = "notify"
+	EventOrder    = "order"
+)
+
+// channelEventTemplates decides which template renders an event for subscribers of a channel or thread.
+var channelEventTemplates = map[string]string{
+	EventMessage:  "message",
+	EventEdited:   "message-update",
+	EventDeleted:  "message-update",
+	EventReplies:  "message-replies-update",
+	EventReaction: "message-reactions-update",
+}
+
+// channelListEventTypes are the events pushed to the channel list, which every page of a user is subscribed to.
+var channelListEventTypes = map[string]bool{
+	EventMessage:  true,
+	EventEdited:   true,
+	EventDeleted:  true,
+	EventMention:  true,
+	EventRead:     true,
+	EventPresence: true,
+	EventRemoved:  true,
+	EventSettings: true,
+	EventNotify:   true,
+	EventOrder:    true,
+}
+
+// subscriberBacklog is how many events may be waiting for a subscriber to handle them.
+const subscriberBacklog = 32
+
 type Event struct {
 	ID              string
 	Type            string
 	Message         model.Message
 	Channel         model.Channel
 	CurrentUserUUID string
+	// NotifyUserUUIDs limits who receives the event on the channel list, as is the case for mentions
+	NotifyUserUUIDs []string
+	// Typists are everyone typing in the channel, as of a typing event
+	Typists []model.User
+	// User is whoever's presence changed, as of a presence event
+	User model.User
+	// Receipts are the read markers moved in the channel, as of a receipt event
+	Receipts []Receipt
+}
+
+func (e Event) isForUser(userUUID string) bool {
+	if e.NotifyUserUUIDs == nil {
+		return true
+	}
+	return slices.Contains(e.NotifyUserUUIDs, userUUID)
+}
+
+// isForThread tells whether the event concerns those viewing the thread. Receipts do if any of them is for the
+// message the thread is about.
+func (e Event) isForThread(threadUUID string) bool {
+	if e.Type == EventReceipt {
+		return slices.ContainsFunc(e.Receipts, func(receipt Receipt) bool {
+			return receipt.Message.UUID == threadUUID
+		})
+	}
+	return threadUUID == e.Message.ThreadUUID()
+}
+
+// isMembershipChange tells whether the event changes the membership of those it is for.
+func (e Event) isMembershipChange() bool {
+	return e.Type == EventRemoved || e.Type == EventRole
 }
 
 func NewEvent(t string, channel model.Channel, message model.Message, currentUserUUID string) Event {
@@ -44,17 +122,28 @@ func NewEvent(t string, channel model.Channel, message model.Message, currentUse
 
 type Broker struct {
 	channelConsumers     map[chan Event]string
+	threadConsumers      map[chan Event]string
 	channelListConsumers map[chan Event]string
-	logger               zerolog.Logger
-	chatService          ChatService
-	mtx                  *sync.Mutex
+	// receiptConsumers are where receipts are delivered to channel and thread consumers, apart from their other events
+	receiptConsumers map[chan Event]chan Event
+	logger           zerolog.Logger
+	chatService      ChatService
+	presenceService  PresenceService
+	typists          *typists
+	readers          *readers
+	mtx              *sync.Mutex
 }
 
-func NewBroker(logger zerolog.Logger, chatService ChatService) *Broker {
+func NewBroker(logger zerolog.Logger, chatService ChatService, presenceService PresenceService) *Broker {
 	return &Broker{
 		channelConsumers:     make(map[chan Event]string),
+		threadConsumers:      make(map[chan Event]string),
 		channelListConsumers: make(map[chan Event]string),
+		receiptConsumers:     make(map[chan Event]chan Event),
 		chatService:          chatService,
+		presenceService:      presenceService,
+		typists:              newTypists(),
+		readers:              newReaders(),
 		mtx:                  new(sync.Mutex),
 		logger:               logger,
 	}
@@ -67,22 +156,39 @@ func (b *Broker) Middleware(next http.Handler) http.Handler {
 	})
 }
 
-func (b *Broker) SubscribeToChannel(channelUUID string) chan Event {
+// SubscribeToChannel returns where the channel's events are delivered, and where its receipts are.
+func (b *Broker) SubscribeToChannel(channelUUID string) (chan Event, chan Event) {
 	b.mtx.Lock()
 	defer b.mtx.Unlock()
 
-	c := make(chan Event)
+	c := make(chan Event, subscriberBacklog)
 	b.channelConsumers[c] = channelUUID
+	receipts := make(chan Event, 1)
+	b.receiptConsumers[c] = receipts
 
 	b.logger.Debug().Msgf("client connected to channel %s", channelUUID)
-	return c
+	return c, receipts
+}
+
+// SubscribeToThread returns where the thread's events are delivered, and where receipts for its message are.
+func (b *Broker) SubscribeToThread(threadUUID string) (chan Event, chan Event) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	c := make(chan Event, subscriberBacklog)
+	b.threadConsumers[c] = threadUUID
+	receipts := make(chan Event, 1)
+	b.receiptConsumers[c] = receipts
+
+	b.logger.Debug().Msgf("client connected to thread %s", threadUUID)
+	return c, receipts
 }
 
 func (b *Broker) SubscribeToChannelListUpdates(userUUID string) chan Event {
 	b.mtx.Lock()
 	defer b.mtx.Unlock()
 
-	c := make(chan Event)
+	c := make(chan Event, subscriberBacklog)
 	b.channelListConsumers[c] = userUUID
 
 	b.logger.Debug().Msgf("client connected to channelList %s", userUUID)
@@ -93,6 +199,11 @@ func (b *Broker) Unsubscribe(c chan Event) {
 	b.mtx.Lock()
 	defer b.mtx.Unlock()
 
+	if receipts, ok := b.receiptConsumers[c]; ok {
+		close(receipts)
+		delete(b.receiptConsumers, c)
+	}
+
 	id := b.channelConsumers[c]
 	if id != "" {
 		close(c)
@@ -100,6 +211,13 @@ func (b *Broker) Unsubscribe(c chan Event) {
 		b.logger.Debug().Msgf("Client %s killed, %d remaining", id, len(b.channelConsumers))
 	}
 
+	id = b.threadConsumers[c]
+	if id != "" {
+		close(c)
+		delete(b.threadConsumers, c)
+		b.logger.Debug().Msgf("Client %s killed, %d remaining", id, len(b.threadConsumers))
+	}
+
 	id = b.channelListConsumers[c]
 	if id != "" {
 		close(c)
@@ -112,17 +230,33 @@ func (b *Broker) Publish(e Event) {
 	b.mtx.Lock()
 	defer b.mtx.Unlock()
 
-	go func() {
+	if channelListEventTypes[e.Type] {
 		// TODO this truly sucks. It will perform a lot of checks which could've been avoided if channel just included a list of its members.
-		for s, _ := range b.channelListConsumers {
-			s <- e
+		for s, userUUID := range b.channelListConsumers {
+			if e.isForUser(userUUID) {
+				b.deliver(s, e)
+			}
 		}
-	}()
+	}
+
+	if e.NotifyUserUUIDs != nil && !e.isMembershipChange() {
+		// Events for specific users are only delivered through the channel list. Membership changes are also delivered
+		// to those viewing the channel, so that whoever was removed stops receiving its events right away, and whoever
+		// got a new role has events presented by it.
+		return
+	}
 
 	pubMsg := 0
 	for s, channelUUID := range b.channelConsumers {
-		if channelUUID == e.Channel.UUID {
-			s <- e
+		// Replies are only pushed to those viewing the thread
+		if channelUUID == e.Channel.UUID && !e.Message.IsReply() {
+			b.deliver(s, e)
+			pubMsg++
+		}
+	}
+	for s, threadUUID := range b.threadConsumers {
+		if e.isForThread(threadUUID) {
+			b.deliver(s, e)
 			pubMsg++
 		}
 	}
@@ -130,7 +264,25 @@ func (b *Broker) Publish(e Event) {
 	b.logger.Debug().Msgf("published message to %d subscribers", pubMsg)
 }
 
+// deliver hands the event to the subscriber without waiting for it, so that a slow or departing subscriber can't hold
+// up the broker. Subscribers lagging too far behind miss the event.
+func (b *Broker) deliver(c chan Event, e Event) {
+	if receipts, ok := b.receiptConsumers[c]; ok && e.Type == EventReceipt {
+		b.deliverReceipts(receipts, e)
+		return
+	}
+	select {
+	case c <- e:
+	default:
+		b.logger.Warn().Msgf("Dropped %s event for subscriber lagging behind", e.Type)
+	}
+}
+
 func (b *Broker) Close() {
+	for k, receipts := range b.receiptConsumers {
+		close(receipts)
+		delete(b.receiptConsumers, k)
+	}
 	for k := range b.channelConsumers {
 		close(k)
 		delete(b.channelConsumers, k)
@@ -138,7 +290,6 @@ func (b *Broker) Close() {
 }
 
 func (b *Broker) ServeHTTPForChannel(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
 	f, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
@@ -147,6 +298,18 @@ func (b *Broker) ServeHTTPForChannel(w http.ResponseWriter, r *http.Request) {
 
 	user := app.GetUserFromContextOrPanic(r.Context())
 
+	channelUUID := chi.URLParam(r, "channelUUID")
+	member, err := b.chatService.GetMember(channelUUID, user.UUID)
+	if err != nil {
+		if errors.Is(err, app.ErrMemberNotFound) {
+			http.Error(w, "channel not found", http.StatusNotFound)
+			return
+		}
+		b.logger.Error().Err(err).Msgf("Failed to look up membership in channel=(%s) for userUUID=(%s)", channelUUID, user.UUID)
+		http.Error(w, "failed to subscribe to channel", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -154,18 +317,103 @@ func (b *Broker) ServeHTTPForChannel(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Create new client channel for stream events
-	c := b.SubscribeToChannel(chi.URLParam(r, "channelUUID"))
+	c, receipts := b.SubscribeToChannel(channelUUID)
 	defer b.Unsubscribe(c)
 
+	b.streamMessageEvents(w, f, r, c, receipts, user, member)
+}
+
+func (b *Broker) ServeHTTPForThread(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	user := app.GetUserFromContextOrPanic(r.Context())
+
+	channelUUID := chi.URLParam(r, "channelUUID")
+	messageUUID := chi.URLParam(r, "messageUUID")
+	member, err := b.chatService.GetMember(channelUUID, user.UUID)
+	if err == nil {
+		// Makes sure the thread actually belongs to the channel the user is a member of
+		_, err = b.chatService.GetMessage(channelUUID, messageUUID, user)
+	}
+	if err != nil {
+		if errors.Is(err, app.ErrMemberNotFound) || errors.Is(err, app.ErrChannelNotFound) || errors.Is(err, app.ErrMessageNotFound) {
+			http.Error(w, "thread not found", http.StatusNotFound)
+			return
+		}
+		b.logger.Error().Err(err).Msgf("Failed to look up thread=(%s) in channel=(%s) for userUUID=(%s)", messageUUID, channelUUID, user.UUID)
+		http.Error(w, "failed to subscribe to thread", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// Create new client channel for stream events
+	c, receipts := b.SubscribeToThread(messageUUID)
+	defer b.Unsubscribe(c)
+
+	b.streamMessageEvents(w, f, r, c, receipts, user, member)
+}
+
+// streamMessageEvents renders each message event, and each receipt event, for the member receiving it, until the
+// request is done.
+func (b *Broker) streamMessageEvents(w http.ResponseWriter, f http.Flusher, r *http.Request, c, receipts chan Event, user model.User, member model.Member) {
+	ctx := r.Context()
 	for {
 		select {
+		case msg := <-receipts:
+			b.sendReceipts(w, f, msg, user)
 		case msg := <-c:
-			if msg.Message.Sender.UUID == user.UUID {
+			// The membership is looked up anew only once changed, and those no longer members receive nothing more
+			if msg.isMembershipChange() {
+				if !msg.isForUser(user.UUID) {
+					continue
+				}
+				var err error
+				member, err = b.chatService.GetMember(member.ChannelUUID, user.UUID)
+				if errors.Is(err, app.ErrMemberNotFound) {
+					b.sendRemoved(w, f, msg.Channel)
+					return
+				}
+				if err != nil {
+					b.logger.Error().Err(err).Msgf("Failed to look up membership in channel=(%s) for userUUID=(%s)", msg.Channel.UUID, user.UUID)
+				}
+				continue
+			}
+			// The user causing the event has already received the result as response to its request
+			if msg.CurrentUserUUID == user.UUID {
+				continue
+			}
+			if msg.Type == EventTyping {
+				b.sendTyping(w, f, msg, user)
+				continue
+			}
+			if msg.Type == EventPin {
+				b.sendPins(w, f, msg, user, member)
 				continue
 			}
+			if msg.Type == EventSettings {
+				b.sendSettings(w, f, msg, member)
+				continue
+			}
+			templateName, ok := channelEventTemplates[msg.Type]
+			if !ok {
+				b.logger.Warn().Msgf("No template for channel event of type=%s", msg.Type)
+				continue
+			}
+			message := presentMessage(msg.Message, user, member)
+			// The read marker is moved by the user's client once the message is seen, not merely delivered
+			message.MarksRead = msg.Type == EventMessage && !message.IsReply()
 			// TODO We generate message fom template for each recipient here. This seems inefficient.
 			buf := bytes.Buffer{}
-			err := templates.Templates.ExecuteTemplate(&buf, "message", msg.Message)
+			err := templates.Templates.ExecuteTemplate(&buf, templateName, message)
 			if err != nil {
 				log.Error().Err(err).Msgf("Failed to execute template")
 				continue
@@ -178,6 +426,59 @@ func (b *Broker) ServeHTTPForChannel(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// presentMessage adjusts the message to the member it is presented to.
+func presentMessage(message model.Message, user model.User, member model.Member) model.Message {
+	message.Direction = model.DirectionIn
+	if message.Sender.UUID == user.UUID {
+		message.Direction = model.DirectionOut
+	}
+	message.IsDeletable = !message.IsDeleted() && member.CanDeleteMessage(message)
+	message.IsPinnable = !message.IsDeleted() && !message.IsReply() && member.Can(model.PermissionPin)
+	message.ReactionCounts = model.CountReactions(message.Reactions, user.UUID)
+	return message
+}
+
+// sendPins updates the channel's pinned messages, and the message pinned or unpinned.
+func (b *Broker) sendPins(w http.ResponseWriter, f http.Flusher, e Event, user model.User, member model.Member) {
+	buf := bytes.Buffer{}
+	err := templates.Templates.ExecuteTemplate(&buf, "channel-pins-update", map[string]any{
+		"Channel": e.Channel,
+		"Message": presentMessage(e.Message, user, member),
+	})
+	if err != nil {
+		b.logger.Error().Err(err).Msgf("Failed to render pins of channel=(%s)", e.Channel.UUID)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, strings.ReplaceAll(buf.String(), "\n", ""))
+	f.Flush()
+}
+
+// sendSettings updates the header of the channel, now that its settings have changed.
+func (b *Broker) sendSettings(w http.ResponseWriter, f http.Flusher, e Event, member model.Member) {
+	channel := e.Channel
+	channel.CurrentUserRole = member.Role
+	buf := bytes.Buffer{}
+	err := templates.Templates.ExecuteTemplate(&buf, "channel-info-update", channel)
+	if err != nil {
+		b.logger.Error().Err(err).Msgf("Failed to render settings of channel=(%s)", channel.UUID)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, strings.ReplaceAll(buf.String(), "\n", ""))
+	f.Flush()
+}
+
+// sendRemoved tells a user no longer a member of the channel so, in place of the channel.
+func (b *Broker) sendRemoved(w http.ResponseWriter, f http.Flusher, channel model.Channel) {
+	buf := bytes.Buffer{}
+	err := templates.Templates.ExecuteTemplate(&buf, "channel-removed", channel)
+	if err != nil {
+		b.logger.Error().Err(err).Msgf("Failed to render removal from channel=(%s)", channel.UUID)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", EventRemoved, strings.ReplaceAll(buf.String(), "\n", ""))
+	f.Flush()
+}
+
 func (b *Broker) ServeHTTPForChannelList(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	f, ok := w.(http.Flusher)
@@ -197,16 +498,35 @@ func (b *Broker) ServeHTTPForChannelList(w http.ResponseWriter, r *http.Request)
 	// Create new client channel for stream events
 	c := b.SubscribeToChannelListUpdates(user.UUID)
 	defer b.Unsubscribe(c)
+	b.connect(user)
+	defer b.disconnect(user)
+
+	// Whoever connects is online, even if already connected elsewhere
+	user.Presence = model.PresenceOnline
+	b.sendPresence(w, f, user)
 
 	for {
 		select {
 		case msg := <-c:
-			_, err := b.chatService.IsMemberOfChannel(msg.Channel.UUID, user.UUID)
-			if err != nil {
-				if !errors.Is(err, app.ErrMemberNotFound) {
-					b.logger.Error().Err(err).Msgf("Failed sending channel=(%s) list update to userUUID=(%s)", msg.Channel.UUID, user.UUID)
+			// Whoever was removed is no longer a member, but still has the channel to lose from the list. Reordering the list
+			// concerns no channel in particular.
+			if msg.Type == EventPresence {
+				// The channel list tells how many are online
+				b.sendPresence(w, f, msg.User)
+			} else if msg.Type != EventRemoved && msg.Type != EventOrder {
+				member, err := b.chatService.GetMember(msg.Channel.UUID, user.UUID)
+				if err != nil {
+					if !errors.Is(err, app.ErrMemberNotFound) {
+						b.logger.Error().Err(err).Msgf("Failed sending channel=(%s) list update to userUUID=(%s)", msg.Channel.UUID, user.UUID)
+					}
+					continue
+				}
+				if msg.Type == EventMention {
+					if member.WantsNotification(true) {
+						b.sendMentionNotification(w, f, msg)
+					}
+					continue
 				}
-				continue
 			}
 			channelList, err := b.chatService.GetChannelList(user)
 			if err != nil {
@@ -227,6 +547,17 @@ func (b *Broker) ServeHTTPForChannelList(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+func (b *Broker) sendMentionNotification(w http.ResponseWriter, f http.Flusher, e Event) {
+	buf := bytes.Buffer{}
+	err := templates.Templates.ExecuteTemplate(&buf, "mention-notification", model.Mention{Message: e.Message, Channel: e.Channel})
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to execute template")
+		return
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", EventMention, strings.ReplaceAll(buf.String(), "\n", ""))
+	f.Flush()
+}
+
 func PublishUsingBrokerInContext(ctx context.Context, event Event) error {
 	if broker, ok := ctx.Value(app.BrokerContextKey).(*Broker); ok {
 		broker.Publish(event)
@@ -0,0 +1,65 @@
+package sse
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/emilhauk/chitchat/templates"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type PresenceService interface {
+	Connect(userUUID string) bool
+	Disconnect(userUUID string) bool
+	GoOffline(userUUID string) bool
+	GetContacts(userUUID string) ([]string, error)
+}
+
+// connect registers the user's connection to the channel list stream, telling the user's contacts if the user just
+// came online.
+func (b *Broker) connect(user model.User) {
+	if b.presenceService.Connect(user.UUID) {
+		b.publishPresence(user, model.PresenceOnline)
+	}
+}
+
+// disconnect unregisters the user's connection to the channel list stream. If it was the user's last one, the user's
+// contacts are told the user is away, and later offline unless the user has come back by then.
+func (b *Broker) disconnect(user model.User) {
+	if !b.presenceService.Disconnect(user.UUID) {
+		return
+	}
+	b.publishPresence(user, model.PresenceAway)
+	time.AfterFunc(model.AwayTimeout, func() {
+		if b.presenceService.GoOffline(user.UUID) {
+			b.publishPresence(user, model.PresenceOffline)
+		}
+	})
+}
+
+func (b *Broker) publishPresence(user model.User, presence model.Presence) {
+	contacts, err := b.presenceService.GetContacts(user.UUID)
+	if err != nil {
+		b.logger.Error().Err(err).Msgf("Failed to publish presence of userUUID=(%s)", user.UUID)
+		return
+	}
+	user.Presence = presence
+	event := NewEvent(EventPresence, model.Channel{}, model.Message{}, user.UUID)
+	event.User = user
+	event.NotifyUserUUIDs = contacts
+	b.Publish(event)
+}
+
+func (b *Broker) sendPresence(w http.ResponseWriter, f http.Flusher, user model.User) {
+	buf := bytes.Buffer{}
+	err := templates.Templates.ExecuteTemplate(&buf, "presence-update", user)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to execute template")
+		return
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", EventPresence, strings.ReplaceAll(buf.String(), "\n", ""))
+	f.Flush()
+}
@@ -0,0 +1,148 @@
+package sse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/emilhauk/chitchat/templates"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// receiptDelay is how long read markers moved in a channel are collected, before those concerned are told in one go.
+const receiptDelay = time.Second
+
+// Receipt tells that the user has read the channel up to and including the message.
+type Receipt struct {
+	User    model.User
+	Message model.Message
+}
+
+// readers collects the read markers moved in each channel, so that members reading along in a busy channel cause a
+// single receipt event rather than one each.
+type readers struct {
+	mtx      sync.Mutex
+	channels map[string]*channelReaders
+}
+
+type channelReaders struct {
+	channel  model.Channel
+	receipts []Receipt
+}
+
+func newReaders() *readers {
+	return &readers{
+		channels: make(map[string]*channelReaders),
+	}
+}
+
+// add collects the receipt for the channel, replacing any earlier one of the same user. It tells whether the receipt
+// is the first collected for the channel, which is when a publish is due to be scheduled.
+func (r *readers) add(channel model.Channel, receipt Receipt) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	current, ok := r.channels[channel.UUID]
+	if !ok {
+		current = &channelReaders{channel: channel}
+		r.channels[channel.UUID] = current
+	}
+	current.receipts = mergeReceipts(current.receipts, []Receipt{receipt})
+	return !ok
+}
+
+// take returns the receipts collected for the channel, and starts collecting anew.
+func (r *readers) take(channelUUID string) (model.Channel, []Receipt) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	current, ok := r.channels[channelUUID]
+	if !ok {
+		return model.Channel{}, nil
+	}
+	delete(r.channels, channelUUID)
+	return current.channel, current.receipts
+}
+
+// mergeReceipts adds the newer receipts to the older ones, leaving out older receipts of users found among the newer.
+func mergeReceipts(older, newer []Receipt) []Receipt {
+	merged := slices.DeleteFunc(slices.Clone(older), func(receipt Receipt) bool {
+		return slices.ContainsFunc(newer, func(newReceipt Receipt) bool {
+			return newReceipt.User.UUID == receipt.User.UUID
+		})
+	})
+	return append(merged, newer...)
+}
+
+// MarkedRead has the user's read receipt moved to the message for the members viewing the channel, and the user's
+// channel list updated. Reads in the channel are collected for receiptDelay, after which a single receipt event tells
+// about all of them.
+func (b *Broker) MarkedRead(channel model.Channel, message model.Message, user model.User) {
+	if b.readers.add(channel, Receipt{User: user, Message: message}) {
+		time.AfterFunc(receiptDelay, func() {
+			b.publishReceipts(channel.UUID)
+		})
+	}
+}
+
+func (b *Broker) publishReceipts(channelUUID string) {
+	channel, receipts := b.readers.take(channelUUID)
+	if len(receipts) == 0 {
+		return
+	}
+	userUUIDs := make([]string, 0, len(receipts))
+	for _, receipt := range receipts {
+		userUUIDs = append(userUUIDs, receipt.User.UUID)
+	}
+	read := NewEvent(EventRead, channel, model.Message{}, "")
+	read.NotifyUserUUIDs = userUUIDs
+	b.Publish(read)
+
+	event := NewEvent(EventReceipt, channel, model.Message{}, "")
+	event.Receipts = receipts
+	b.Publish(event)
+}
+
+// deliverReceipts hands the receipt event to the subscriber apart from its other events, so that receipts never crowd
+// out messages. Receipts the subscriber has yet to take are merged with the new ones rather than dropped.
+func (b *Broker) deliverReceipts(c chan Event, e Event) {
+	select {
+	case pending := <-c:
+		e.Receipts = mergeReceipts(pending.Receipts, e.Receipts)
+	default:
+	}
+	// The broker is the only one sending, and holds its lock while doing so, so there is always room by now
+	c <- e
+}
+
+// sendReceipts renders the receipts for the user, leaving out the user's own.
+func (b *Broker) sendReceipts(w http.ResponseWriter, f http.Flusher, e Event, user model.User) {
+	others := slices.DeleteFunc(slices.Clone(e.Receipts), func(receipt Receipt) bool {
+		return receipt.User.UUID == user.UUID
+	})
+	if len(others) == 0 {
+		return
+	}
+	buf := bytes.Buffer{}
+	err := templates.Templates.ExecuteTemplate(&buf, "message-receipts-update", others)
+	if err != nil {
+		b.logger.Error().Err(err).Msgf("Failed to render receipts in channel=(%s)", e.Channel.UUID)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", EventReceipt, strings.ReplaceAll(buf.String(), "\n", ""))
+	f.Flush()
+}
+
+func MarkedReadUsingBrokerInContext(ctx context.Context, channel model.Channel, message model.Message, user model.User) error {
+	if broker, ok := ctx.Value(app.BrokerContextKey).(*Broker); ok {
+		broker.MarkedRead(channel, message, user)
+		return nil
+	}
+	return errors.New("no message broker found in context")
+}
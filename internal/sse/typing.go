@@ -0,0 +1,145 @@
+package sse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	app "github.com/emilhauk/chitchat/internal"
+	"github.com/emilhauk/chitchat/internal/model"
+	"github.com/emilhauk/chitchat/templates"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// typingTimeout is how long someone is considered to be typing without telling again.
+const typingTimeout = 5 * time.Second
+
+// typists keeps track of who is typing in which channel. It lives in memory only, as nobody cares who was typing
+// once the server is restarted.
+type typists struct {
+	mtx      sync.Mutex
+	channels map[string]map[string]typist
+}
+
+type typist struct {
+	user      model.User
+	expiresAt time.Time
+}
+
+func newTypists() *typists {
+	return &typists{
+		channels: make(map[string]map[string]typist),
+	}
+}
+
+// start marks the user as typing in the channel until typingTimeout has passed. It tells whether the user just
+// started typing, as opposed to still typing.
+func (t *typists) start(channelUUID string, user model.User) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.channels[channelUUID] == nil {
+		t.channels[channelUUID] = make(map[string]typist)
+	}
+	_, wasTyping := t.channels[channelUUID][user.UUID]
+	t.channels[channelUUID][user.UUID] = typist{
+		user:      user,
+		expiresAt: time.Now().Add(typingTimeout),
+	}
+	return !wasTyping
+}
+
+// stop unmarks the user as typing in the channel. Unless force is set, it is only done if the user hasn't typed
+// again since. It tells whether the user was unmarked.
+func (t *typists) stop(channelUUID, userUUID string, force bool) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	current, ok := t.channels[channelUUID][userUUID]
+	if !ok || (!force && time.Now().Before(current.expiresAt)) {
+		return false
+	}
+	delete(t.channels[channelUUID], userUUID)
+	if len(t.channels[channelUUID]) == 0 {
+		delete(t.channels, channelUUID)
+	}
+	return true
+}
+
+// list returns the users typing in the channel, ordered by name.
+func (t *typists) list(channelUUID string) []model.User {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	users := make([]model.User, 0, len(t.channels[channelUUID]))
+	for _, current := range t.channels[channelUUID] {
+		users = append(users, current.user)
+	}
+	slices.SortFunc(users, func(a, b model.User) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return users
+}
+
+// StartTyping tells the other subscribers of the channel that the user is typing. Unless the user tells so again, it
+// expires after typingTimeout.
+func (b *Broker) StartTyping(channel model.Channel, user model.User) {
+	if b.typists.start(channel.UUID, user) {
+		b.publishTyping(channel, user)
+	}
+	time.AfterFunc(typingTimeout, func() {
+		if b.typists.stop(channel.UUID, user.UUID, false) {
+			b.publishTyping(channel, user)
+		}
+	})
+}
+
+// StopTyping tells the other subscribers of the channel that the user is no longer typing, typically as the message
+// has been sent.
+func (b *Broker) StopTyping(channel model.Channel, user model.User) {
+	if b.typists.stop(channel.UUID, user.UUID, true) {
+		b.publishTyping(channel, user)
+	}
+}
+
+func (b *Broker) publishTyping(channel model.Channel, user model.User) {
+	event := NewEvent(EventTyping, channel, model.Message{}, user.UUID)
+	event.Typists = b.typists.list(channel.UUID)
+	b.Publish(event)
+}
+
+// sendTyping renders who is typing for the user, leaving out the user itself.
+func (b *Broker) sendTyping(w http.ResponseWriter, f http.Flusher, e Event, user model.User) {
+	others := slices.DeleteFunc(slices.Clone(e.Typists), func(typist model.User) bool {
+		return typist.UUID == user.UUID
+	})
+	buf := bytes.Buffer{}
+	err := templates.Templates.ExecuteTemplate(&buf, "typing", others)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to execute template")
+		return
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", EventTyping, strings.ReplaceAll(buf.String(), "\n", ""))
+	f.Flush()
+}
+
+func StartTypingUsingBrokerInContext(ctx context.Context, channel model.Channel, user model.User) error {
+	if broker, ok := ctx.Value(app.BrokerContextKey).(*Broker); ok {
+		broker.StartTyping(channel, user)
+		return nil
+	}
+	return errors.New("no message broker found in context")
+}
+
+func StopTypingUsingBrokerInContext(ctx context.Context, channel model.Channel, user model.User) error {
+	if broker, ok := ctx.Value(app.BrokerContextKey).(*Broker); ok {
+		broker.StopTyping(channel, user)
+		return nil
+	}
+	return errors.New("no message broker found in context")
+}
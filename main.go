@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"github.com/emilhauk/chitchat/config"
+	"github.com/emilhauk/chitchat/internal/blob"
 	"github.com/emilhauk/chitchat/internal/controller"
 	"github.com/emilhauk/chitchat/internal/database"
+	"github.com/emilhauk/chitchat/internal/mailer"
 	"github.com/emilhauk/chitchat/internal/manager"
 	internalMiddleware "github.com/emilhauk/chitchat/internal/middleware"
 	"github.com/emilhauk/chitchat/internal/server"
@@ -19,10 +21,19 @@ var (
 	sessionManager      manager.Session
 	channelManager      manager.Channel
 	messageManager      manager.Message
+	reactionManager     manager.Reaction
+	mentionManager      manager.Mention
+	attachmentManager   manager.Attachment
+	avatarManager       manager.Avatar
+	pinManager          manager.Pin
+	invitationManager   manager.Invitation
+	outboxManager       manager.Outbox
 	verificationManager manager.Verification
 	credentialManager   manager.Credential
 	chatService         service.Chat
+	presenceService     service.Presence
 	registerService     service.Register
+	searchService       service.Search
 )
 
 func main() {
@@ -40,19 +51,64 @@ func main() {
 	sessionManager = manager.NewSessionManager(dbStore.Sessions)
 	channelManager = manager.NewChannelManager(dbStore.Channels)
 	messageManager = manager.NewMessageManager(dbStore.Messages)
-	verificationManager = manager.NewVerificationManager(dbStore.Verifications)
+	reactionManager = manager.NewReactionManager(dbStore.Reactions)
+	mentionManager = manager.NewMentionManager(dbStore.Mentions)
+	blobStore := newBlobStore(config.Storage)
+	attachmentManager = manager.NewAttachmentManager(dbStore.Attachments, blobStore)
+	avatarManager = manager.NewAvatarManager(blobStore)
+	pinManager = manager.NewPinManager(dbStore.Pins)
+	invitationManager = manager.NewInvitationManager(dbStore.Invitations)
+	outboxManager = manager.NewOutboxManager(dbStore.Outbox, newMailSender(config.Mail))
+	verificationManager = manager.NewVerificationManager(dbStore.Verifications, outboxManager)
 	credentialManager = manager.NewCredentialManager(dbStore.Credentials)
 
-	chatService = service.NewChatService(userManager, channelManager, messageManager)
+	presenceService = service.NewPresenceService(sessionManager, channelManager)
+	chatService = service.NewChatService(userManager, channelManager, messageManager, reactionManager, mentionManager, attachmentManager, avatarManager, pinManager, invitationManager, presenceService)
 	registerService = service.NewRegisterService(userManager, verificationManager, credentialManager)
+	searchService = service.NewSearchService(userManager, channelManager, messageManager)
 
 	// TODO This stinks. Should provide better wrapper for controllers
 	controller.ProvideManagers(userManager, sessionManager, channelManager, messageManager)
-	controller.ProvideServices(chatService, registerService)
+	controller.ProvideServices(chatService, registerService, searchService)
 
 	authMiddleware := internalMiddleware.NewAuthMiddleware(userManager, sessionManager)
-	sseBroker := sse.NewBroker(config.Logger, chatService)
+	sseBroker := sse.NewBroker(config.Logger, chatService, presenceService)
 	router := server.NewRouter(authMiddleware, sseBroker)
 
+	if config.Mail.Enabled {
+		go outboxManager.Run(ctx)
+	}
+
 	server.Start(ctx, router)
 }
+
+func newBlobStore(storage config.StorageConfig) blob.Store {
+	var (
+		store blob.Store
+		err   error
+	)
+	switch storage.Driver {
+	case "local":
+		store, err = blob.NewLocalStore(storage.LocalDirectory)
+	case "s3":
+		store, err = blob.NewS3Store(storage.S3Endpoint, storage.S3Region, storage.S3Bucket, storage.S3AccessKey, storage.S3SecretKey, storage.S3PathStyle)
+	default:
+		log.Fatal().Msgf("Unknown storage driver %q. Use either local or s3", storage.Driver)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to set up %s storage", storage.Driver)
+	}
+	return store
+}
+
+// newMailSender returns nil when sending email is disabled, as nothing is put in the outbox then.
+func newMailSender(mail config.SMTPConfig) manager.MailSender {
+	if !mail.Enabled {
+		return nil
+	}
+	sender, err := mailer.NewSMTPSender(mail)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up sending of email")
+	}
+	return sender
+}
@@ -0,0 +1,2 @@
+ALTER TABLE messages
+    ADD INDEX channel_sent_idx (channel_uuid, sent_at, uuid);
@@ -0,0 +1,4 @@
+ALTER TABLE messages
+    ADD COLUMN parent_uuid VARCHAR(36) NULL AFTER user_uuid,
+    ADD INDEX parent_idx (parent_uuid),
+    ADD CONSTRAINT FOREIGN KEY parent_fk (parent_uuid) REFERENCES messages(uuid) ON DELETE CASCADE;
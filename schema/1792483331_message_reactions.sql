@@ -0,0 +1,13 @@
+CREATE TABLE message_reactions (
+    message_uuid VARCHAR(36) NOT NULL,
+    user_uuid VARCHAR(36) NOT NULL,
+    emoji VARCHAR(16) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    PRIMARY KEY (message_uuid, user_uuid, emoji),
+
+    INDEX message_idx (message_uuid),
+
+    CONSTRAINT FOREIGN KEY message_fk (message_uuid) REFERENCES messages(uuid) ON DELETE CASCADE,
+    CONSTRAINT FOREIGN KEY user_fk (user_uuid) REFERENCES users(uuid) ON DELETE CASCADE
+) CHARSET utf8, ENGINE InnoDB;
@@ -0,0 +1,12 @@
+CREATE TABLE message_mentions (
+    message_uuid VARCHAR(36) NOT NULL,
+    user_uuid VARCHAR(36) NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    PRIMARY KEY (message_uuid, user_uuid),
+
+    INDEX user_idx (user_uuid),
+
+    CONSTRAINT FOREIGN KEY message_fk (message_uuid) REFERENCES messages(uuid) ON DELETE CASCADE,
+    CONSTRAINT FOREIGN KEY user_fk (user_uuid) REFERENCES users(uuid) ON DELETE CASCADE
+) CHARSET utf8, ENGINE InnoDB;
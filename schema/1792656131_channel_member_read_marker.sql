@@ -0,0 +1,3 @@
+ALTER TABLE channel_members
+    ADD COLUMN last_read_message_uuid VARCHAR(36) NULL AFTER role,
+    ADD COLUMN last_read_at DATETIME NULL AFTER last_read_message_uuid;
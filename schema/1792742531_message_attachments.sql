@@ -0,0 +1,16 @@
+CREATE TABLE message_attachments (
+    uuid VARCHAR(36) NOT NULL PRIMARY KEY,
+    message_uuid VARCHAR(36) NOT NULL,
+    channel_uuid VARCHAR(36) NOT NULL,
+    file_name VARCHAR(255) CHARACTER SET utf8mb4 NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    thumbnail_key VARCHAR(255) NULL,
+    created_at DATETIME NOT NULL,
+
+    INDEX message_idx (message_uuid),
+
+    CONSTRAINT FOREIGN KEY message_fk (message_uuid) REFERENCES messages(uuid) ON DELETE CASCADE,
+    CONSTRAINT FOREIGN KEY channel_fk (channel_uuid) REFERENCES channels(uuid) ON DELETE CASCADE
+) CHARSET utf8, ENGINE InnoDB;
@@ -0,0 +1 @@
+ALTER TABLE messages ADD FULLTEXT INDEX content_fulltext_idx (content);
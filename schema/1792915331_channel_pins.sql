@@ -0,0 +1,12 @@
+CREATE TABLE channel_pins (
+    channel_uuid VARCHAR(36) NOT NULL,
+    message_uuid VARCHAR(36) NOT NULL,
+    pinned_by VARCHAR(36) NOT NULL,
+    pinned_at DATETIME NOT NULL,
+
+    PRIMARY KEY (channel_uuid, message_uuid),
+
+    CONSTRAINT FOREIGN KEY channel_fk (channel_uuid) REFERENCES channels(uuid) ON DELETE CASCADE,
+    CONSTRAINT FOREIGN KEY message_fk (message_uuid) REFERENCES messages(uuid) ON DELETE CASCADE,
+    CONSTRAINT FOREIGN KEY pinned_by_fk (pinned_by) REFERENCES users(uuid) ON DELETE CASCADE
+) CHARSET utf8, ENGINE InnoDB;
@@ -0,0 +1,6 @@
+-- Direct channels are between two users only. direct_key is made from the UUIDs of both, so that any pair of users
+-- share at most one direct channel.
+ALTER TABLE channels
+    ADD COLUMN kind VARCHAR(10) NOT NULL DEFAULT 'group',
+    ADD COLUMN direct_key VARCHAR(73) NULL,
+    ADD UNIQUE INDEX direct_key_idx (direct_key);
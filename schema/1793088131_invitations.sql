@@ -0,0 +1,15 @@
+CREATE TABLE invitations (
+    code VARCHAR(32) NOT NULL PRIMARY KEY,
+    channel_uuid VARCHAR(36) NOT NULL,
+    created_by VARCHAR(36) NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NULL,
+    max_uses INT NULL,
+    uses INT NOT NULL DEFAULT 0,
+    revoked_at DATETIME NULL,
+
+    INDEX channel_idx (channel_uuid),
+
+    CONSTRAINT FOREIGN KEY channel_fk (channel_uuid) REFERENCES channels(uuid) ON DELETE CASCADE,
+    CONSTRAINT FOREIGN KEY created_by_fk (created_by) REFERENCES users(uuid) ON DELETE CASCADE
+) CHARSET utf8, ENGINE InnoDB;
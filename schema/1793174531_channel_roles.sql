@@ -0,0 +1,16 @@
+UPDATE channel_members SET role = 'member' WHERE role IS NULL OR role = '';
+
+ALTER TABLE channel_members
+    MODIFY COLUMN role VARCHAR(10) NOT NULL DEFAULT 'member';
+
+-- Whoever has been admin of a group channel the longest becomes its owner
+UPDATE channel_members cm
+    INNER JOIN (
+        SELECT admins.channel_uuid, MIN(admins.created_at) AS created_at
+        FROM channel_members admins
+            INNER JOIN channels c ON c.uuid = admins.channel_uuid
+        WHERE admins.role = 'admin' AND c.kind = 'group'
+        GROUP BY admins.channel_uuid
+    ) first_admin ON first_admin.channel_uuid = cm.channel_uuid AND first_admin.created_at = cm.created_at
+SET cm.role = 'owner'
+WHERE cm.role = 'admin';
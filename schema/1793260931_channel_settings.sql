@@ -0,0 +1,4 @@
+ALTER TABLE channels
+    ADD COLUMN topic VARCHAR(255) NULL AFTER name,
+    ADD COLUMN description TEXT NULL AFTER topic,
+    ADD COLUMN avatar_key VARCHAR(255) NULL AFTER description;
@@ -0,0 +1,3 @@
+-- Archived channels are kept for reading only, until brought back into use.
+ALTER TABLE channels
+    ADD COLUMN archived_at DATETIME NULL AFTER updated_at;
@@ -0,0 +1,4 @@
+-- Public channels are listed in the directory, where anyone may join them. Others are reached by invitation only.
+ALTER TABLE channels
+    ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'private' AFTER kind,
+    ADD INDEX visibility_idx (visibility);
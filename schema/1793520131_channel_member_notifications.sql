@@ -0,0 +1,4 @@
+-- Members choose what in a channel they are notified of. Muting may be limited to last until muted_until.
+ALTER TABLE channel_members
+    ADD COLUMN notify VARCHAR(10) NOT NULL DEFAULT 'all' AFTER role,
+    ADD COLUMN muted_until DATETIME NULL AFTER notify;
@@ -0,0 +1,5 @@
+-- Members may mark channels as favourites, and order their channel list by hand. Channels never ordered by hand have
+-- no sort_order, and are ordered by their latest activity.
+ALTER TABLE channel_members
+    ADD COLUMN is_favourite BOOLEAN NOT NULL DEFAULT FALSE AFTER muted_until,
+    ADD COLUMN sort_order INT NULL AFTER is_favourite;
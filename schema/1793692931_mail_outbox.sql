@@ -0,0 +1,15 @@
+-- Emails are put in the outbox before they are sent, so that they survive restarts and are retried when sending fails.
+CREATE TABLE mail_outbox (
+    uuid VARCHAR(36) NOT NULL PRIMARY KEY,
+    recipient VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    text_body TEXT NOT NULL,
+    html_body TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(1024) NULL,
+    next_attempt_at DATETIME NOT NULL,
+    sent_at DATETIME NULL,
+
+    INDEX pending_idx (sent_at, next_attempt_at)
+) CHARSET utf8, ENGINE InnoDB;
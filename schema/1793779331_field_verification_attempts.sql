@@ -0,0 +1,3 @@
+-- Wrong codes are counted, so that a verification may only be attempted a few times before it has to be started over.
+ALTER TABLE field_verifications
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0 AFTER field_value;